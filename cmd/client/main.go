@@ -1,101 +1,255 @@
 package main
 
 import (
-	"encoding/binary"
+	"flag"
 	"fmt"
-	"math"
-	"math/rand"
-	"net"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/client"
+	"github.com/omersuve/go-parallel-sign/pkg/logging"
 	"github.com/omersuve/go-parallel-sign/pkg/primes"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
 )
 
 func main() {
-	conn, err := net.Dial("tcp", "localhost:3000")
+	addr := flag.String("addr", "localhost:3000", "server address")
+	roomName := flag.String("room", "default", "name of the room to join")
+	workers := flag.Int("workers", 1, "number of goroutines generating, signing and submitting primes")
+	keyAlgorithm := flag.String("key", "rsa", "key algorithm (rsa, ed25519)")
+	numConns := flag.Int("conns", 1, "number of connections to the server, each with its own key and client ID, shared by the workers")
+	logLevel := flag.String("log-level", "info", "log level (debug, info, warn, error)")
+	logFormat := flag.String("log-format", "text", "log format (text, json)")
+	showLeaderboard := flag.Bool("leaderboard", true, "subscribe to the room's leaderboard and log the client's rank")
+	strategyName := flag.String("strategy", "random", "how workers pick primes (random, sequential, assigned, stride, leased)")
+	rangeLo := flag.Int64("lo", 2, "start of the range searched by the sequential and stride strategies")
+	rangeHi := flag.Int64("hi", primes.MaxRange, "end, exclusive, of the range searched by the sequential and stride strategies")
+	strideCount := flag.Int("stride", 16, "number of clients sharing the range with the stride strategy, each takes the blocks of its client ID")
+	seedFlag := flag.Uint64("seed", 0, "seed of the workers' random generators, to replay a run with the same -workers (0 draws one from crypto/rand)")
+	reconnects := flag.Int("reconnect", 5, "attempts to reconnect and resume the session when the connection drops (0 exits instead)")
+	certify := flag.Bool("certify", false, "attach a primality certificate to every submission so the server verifies it instead of testing the number")
+	batch := flag.Int("batch", 1, "numbers each worker submits per frame, the server verifies their signatures together (1 submits them one by one, required by -certify)")
+	rotateEvery := flag.Duration("rotate-key", 0, "replace each connection's key with a new one at this interval, keeping its client ID and score (0 never rotates)")
+	logSample := flag.Int("log-sample", 100, "per second, log the first N occurrences of an event below warn level then every Nth (0 disables sampling)")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, logging.Options{Level: *logLevel, Format: *logFormat, Sample: *logSample})
 	if err != nil {
-		fmt.Println("Error connecting:", err)
+		fmt.Println("Error configuring logging:", err)
 		return
 	}
-	defer conn.Close()
+	slog.SetDefault(logger)
 
-	// Generate RSA key pair
-	keys, err := auth.GenerateKeys()
+	if *workers < 1 || *numConns < 1 || *numConns > *workers {
+		slog.Error("invalid -workers or -conns, need 1 <= conns <= workers", "workers", *workers, "conns", *numConns)
+		return
+	}
+	if *batch < 1 || *batch > protocol.MaxBatch {
+		slog.Error("invalid -batch value", "batch", *batch, "max", protocol.MaxBatch)
+		return
+	}
+	if *certify && *batch > 1 {
+		slog.Error("-certify needs -batch=1, certificates cannot be attached to batched numbers")
+		return
+	}
+	algorithm, err := auth.ParseAlgorithm(*keyAlgorithm)
 	if err != nil {
-		fmt.Println("Error generating keys:", err)
+		slog.Error("invalid -key", "err", err)
 		return
 	}
-
-	// Send public key to server
-	pubBytes, err := auth.PublicKey2Bytes(keys.PublicKey)
+	strategy, err := primes.ParseStrategy(*strategyName)
 	if err != nil {
-		fmt.Println("Error having bytes of public key:", err)
+		slog.Error("invalid -strategy", "err", err)
+		return
+	}
+	seed := primes.Seed(*seedFlag)
+	if seed == 0 {
+		if seed, err = primes.NewSeed(); err != nil {
+			slog.Error("drawing a random seed", "err", err)
+			return
+		}
+	}
+	logger.Info("random generators seeded, pass -seed to replay the run", "seed", uint64(seed))
+	if *strideCount < 1 || *rangeLo >= *rangeHi {
+		slog.Error("invalid -stride or range, need stride >= 1 and lo < hi", "stride", *strideCount, "lo", *rangeLo, "hi", *rangeHi)
 		return
 	}
 
-	// fmt.Printf("Generated Public Key (PEM):\n%s", string(pubBytes))
+	clients := make([]*client.Client, 0, *numConns)
+	loggers := make([]*slog.Logger, 0, *numConns)
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+	for i := 0; i < *numConns; i++ {
+		c, connLogger, err := connect(client.Config{Addr: *addr, Room: *roomName, Algorithm: algorithm, Reconnects: *reconnects,
+			WantRange: strategy == primes.StrategyAssigned, Certify: *certify}, logger, *showLeaderboard)
+		if err != nil {
+			slog.Error("joining room", "err", err)
+			return
+		}
+		clients = append(clients, c)
+		loggers = append(loggers, connLogger)
+	}
 
-	_, err = conn.Write(pubBytes)
+	// Workers are spread over the connections, the run ends as soon as one of them stops
+	// Workers generate numbers valid for the rule the server announced
+	validator, err := primes.ParseValidator(clients[0].Welcome().Rule)
 	if err != nil {
-		fmt.Println("Error sending public key:", err)
-		return
+		slog.Warn("unknown rule, submitting primes", "err", err)
+		validator, _ = primes.ParseValidator("prime")
 	}
 
-	// Receive client ID from server
-	var clientID int32
-	err = binary.Read(conn, binary.LittleEndian, &clientID)
-	if err != nil {
-		fmt.Println("Error reading client ID:", err)
-		return
+	// Workers of a connection split the unit assigned in its welcome
+	var assigned []*assignedUnit
+	if strategy == primes.StrategyAssigned {
+		for i, c := range clients {
+			connWorkers := (*workers - i + len(clients) - 1) / len(clients)
+			assigned = append(assigned, newAssignedUnit(c, validator, connWorkers, loggers[i]))
+		}
 	}
-	fmt.Printf("Client ID: %d\n", clientID)
 
-	// Create a local random generator seeded with clientID
-	rng := rand.New(rand.NewSource(int64(clientID)))
+	// Workers of a connection search its leased units together
+	var leased []*leasedStrategy
+	if strategy == primes.StrategyLeased {
+		for i, c := range clients {
+			leased = append(leased, newLeasedStrategy(c, validator, loggers[i]))
+		}
+	}
 
-	for {
-		// Generating a random prime using the local RNG
-		num := primes.GenerateRandomPrime(math.MaxInt32, rng)
-		signature, err := auth.Sign(num, keys.PrivateKey)
-		if err != nil {
-			fmt.Println("Error signing number:", err)
-			return
+	stats := make([]workerStats, *workers)
+	stop := make(chan struct{})
+	if *rotateEvery > 0 {
+		for i, c := range clients {
+			go rotateKeys(c, algorithm, *rotateEvery, loggers[i], stop)
 		}
+	}
+	var stopOnce sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		c, workerLogger := clients[i%len(clients)], loggers[i%len(clients)]
+		if *workers > 1 {
+			workerLogger = workerLogger.With("worker", i)
+		}
+		// Each worker has its own stream of the run's seed
+		rng := seed.Rand(i)
+		// Workers of a connection split its share of the numbers
+		connWorkers := (*workers - i%len(clients) + len(clients) - 1) / len(clients)
+		var gen primes.Strategy
+		if leased != nil {
+			gen = leased[i%len(clients)]
+		} else if assigned != nil && assigned[i%len(clients)] != nil {
+			gen = assigned[i%len(clients)].part(i/len(clients), connWorkers)
+		} else {
+			gen = newStrategy(strategy, validator, c, rng, *rangeLo, *rangeHi, *strideCount, i/len(clients), connWorkers)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runWorker(c, gen, validator, rng, *batch, workerLogger, &stats[i], stop)
+			stopOnce.Do(func() { close(stop) })
+		}()
+	}
+	wg.Wait()
 
-		// fmt.Printf("Sending Number: %d, Signature (hex): %s", num, hex.EncodeToString(signature))
+	if *workers > 1 {
+		var total workerStats
+		for i, s := range stats {
+			logWorkerStats(logger.With("worker", i, "client_id", clients[i%len(clients)].ID()), "worker finished", s)
+			total.Submitted += s.Submitted
+			total.Accepted += s.Accepted
+			total.Duplicate += s.Duplicate
+			total.Rejected += s.Rejected
+			total.NotCounted += s.NotCounted
+			total.Elapsed = max(total.Elapsed, s.Elapsed)
+		}
+		logWorkerStats(logger.With("seed", uint64(seed)), "all workers finished", total)
+	}
+}
 
-		err = binary.Write(conn, binary.LittleEndian, num)
-		if err != nil {
-			fmt.Println("Error sending:", err)
+// Dials the server and joins the room, returns the client and a logger describing it
+func connect(cfg client.Config, logger *slog.Logger, subscribe bool) (*client.Client, *slog.Logger, error) {
+	// Connect, generate a key pair and join the room
+	var clientID int32
+	cfg.OnAnnouncement = func(a protocol.Announcement) {
+		switch a.Kind {
+		case protocol.AnnounceRoundResult:
+			logger.Info("round finished", "round", a.Round, "accepted", a.Scoreboard[clientID])
+		case protocol.AnnounceMessage:
+			logger.Info("announcement from server", "message", a.Message)
+		}
+	}
+	cfg.OnLeaderboard = func(lb protocol.Leaderboard) {
+		if lb.You == nil {
 			return
 		}
-		_, err = conn.Write(signature)
-		if err != nil {
-			fmt.Println("Error sending signature:", err)
+		logger.Info("current rank", "rank", lb.You.Rank, "clients", lb.Clients, "score", lb.You.Score,
+			"pool_length", lb.PoolLength, "max", lb.Max)
+	}
+	cfg.OnReconnect = func(w protocol.Welcome) {
+		if w.Resumed {
+			logger.Info("reconnected, session resumed", "acked", w.Acked)
 			return
 		}
+		clientID = w.ClientID
+		logger.Warn("reconnected as a new client, the session could not be resumed", "new_client_id", w.ClientID)
+	}
+	c, err := client.Dial(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		var response int32
-		err = binary.Read(conn, binary.LittleEndian, &response)
-		if err != nil {
-			fmt.Println("Error reading feedback:", err)
-			return
+	fingerprint, err := auth.Fingerprint(c.Keys().PublicKey())
+	if err != nil {
+		c.Close()
+		return nil, nil, fmt.Errorf("fingerprinting public key: %w", err)
+	}
+	welcome := c.Welcome()
+	clientID = c.ID()
+	logger = logger.With("key_fingerprint", fingerprint, "client_id", clientID, "room", welcome.Room)
+	logger.Info("joined room", "max", welcome.Max, "rule", welcome.Rule, "rounds", welcome.Rounds)
+	if subscribe {
+		if err := c.SubscribeLeaderboard(true); err != nil {
+			c.Close()
+			return nil, nil, fmt.Errorf("subscribing to the leaderboard: %w", err)
 		}
+	}
+	return c, logger, nil
+}
 
-		if response == -1 {
-            fmt.Printf("Sent %d: Successfully added (completing collection)\n", num)
-			fmt.Println("Server has collected all numbers, exiting")
-            return
-		} else if response == -2 {
-			fmt.Println("Server has collected all numbers, exiting")
+// Replaces the key of the connection every interval until stop is closed
+func rotateKeys(c *client.Client, algorithm auth.Algorithm, interval time.Duration, logger *slog.Logger, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
 			return
-        } else if response == 1 {
-            fmt.Printf("Sent %d: Successfully added\n", num)
-		} else if response == 0 {
-			fmt.Printf("Sent %d: Rejected (duplicate)\n", num)
-		} else if response == -3 {
-			fmt.Printf("Sent %d: Rejected (invalid signature)\n", num)
+		case <-ticker.C:
 		}
-        // time.Sleep(500 * time.Millisecond)
+		keys, err := auth.GenerateKeyPair(algorithm)
+		if err != nil {
+			logger.Error("generating keys", "err", err)
+			return
+		}
+		if err := c.RotateKey(keys); err != nil {
+			logger.Warn("rotating key", "err", err)
+			continue
+		}
+		fingerprint, _ := auth.Fingerprint(keys.PublicKey())
+		logger.Info("key rotated", "new_key_fingerprint", fingerprint)
+	}
+}
+
+func logWorkerStats(logger *slog.Logger, msg string, s workerStats) {
+	var perSecond float64
+	if s.Elapsed > 0 {
+		perSecond = float64(s.Accepted) / s.Elapsed.Seconds()
 	}
-}
\ No newline at end of file
+	logger.Info(msg, "submitted", s.Submitted, "accepted", s.Accepted, "duplicate", s.Duplicate,
+		"rejected", s.Rejected, "not_counted", s.NotCounted, "elapsed", s.Elapsed, "accepted_per_second", perSecond)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/client"
+	"github.com/omersuve/go-parallel-sign/pkg/primes"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Submission counts of a worker
+type workerStats struct {
+	Submitted  int
+	Accepted   int
+	Duplicate  int
+	Rejected   int // Invalid signature or number
+	NotCounted int // Sent while paused or during a round change
+	Elapsed    time.Duration
+}
+
+// Creates the strategy of the worker-th of the workers sharing the connection, yielding numbers valid for the room's rule.
+// Stride blocks are interleaved by client ID, then by worker, so clients must use the same -workers to stay disjoint.
+func newStrategy(name string, v primes.Validator, c *client.Client, rng *rand.Rand, lo, hi int64, strideCount, worker, workers int) primes.Strategy {
+	lo, hi = primes.Bounds(v, lo, hi)
+	switch name {
+	case primes.StrategySequential:
+		lo, hi = primes.Split(lo, hi, worker, workers)
+		return primes.Matching(primes.NewSieve(lo, hi), v)
+	case primes.StrategyAssigned:
+		// The server did not assign a range, see assignedUnit otherwise
+		return primes.RandomFor(v, rng)
+	case primes.StrategyStride:
+		return primes.Matching(primes.NewStride(lo, hi, int(c.ID())%strideCount*workers+worker, strideCount*workers), v)
+	default:
+		return primes.RandomFor(v, rng)
+	}
+}
+
+// Work unit granted in the welcome, split between the workers of a connection. The unit is reported as
+// completed once every worker exhausted its part.
+type assignedUnit struct {
+	c         *client.Client
+	id        int64
+	rng       protocol.Range
+	validator primes.Validator
+	logger    *slog.Logger
+
+	mu        sync.Mutex
+	searching int // Workers still searching their part
+	found     int // Numbers yielded from the unit
+}
+
+// Returns nil if the server did not assign a unit to the connection
+func newAssignedUnit(c *client.Client, v primes.Validator, workers int, logger *slog.Logger) *assignedUnit {
+	w := c.Welcome()
+	if w.Range == nil {
+		return nil
+	}
+	logger.Info("work unit assigned", "unit", w.UnitID, "lo", w.Range.Lo, "hi", w.Range.Hi)
+	return &assignedUnit{c: c, id: w.UnitID, rng: *w.Range, validator: v, logger: logger, searching: workers}
+}
+
+// Numbers of the worker-th part of the unit
+func (u *assignedUnit) part(worker, workers int) primes.Strategy {
+	lo, hi := primes.Split(u.rng.Lo, u.rng.Hi, worker, workers)
+	return &unitPart{unit: u, gen: primes.Matching(primes.NewSieve(lo, hi), u.validator)}
+}
+
+// Counts a part as searched and completes the unit once it was the last one
+func (u *assignedUnit) partDone() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.searching--; u.searching > 0 {
+		return
+	}
+	if err := u.c.Complete(u.id, u.found); err != nil {
+		u.logger.Warn("completing work unit", "unit", u.id, "err", err)
+	} else {
+		u.logger.Info("work unit completed", "unit", u.id, "found", u.found)
+	}
+}
+
+// A worker's part of an assigned unit
+type unitPart struct {
+	unit *assignedUnit
+	gen  primes.Strategy
+	done bool
+}
+
+func (p *unitPart) Next() (int32, bool) {
+	if p.done {
+		return 0, false
+	}
+	if n, ok := p.gen.Next(); ok {
+		p.unit.mu.Lock()
+		p.unit.found++
+		p.unit.mu.Unlock()
+		return n, true
+	}
+	p.done = true
+	p.unit.partDone()
+	return 0, false
+}
+
+// Searches the work units leased from the server one after the other, shared by the workers of a connection
+type leasedStrategy struct {
+	c         *client.Client
+	validator primes.Validator
+	logger    *slog.Logger
+
+	mu    sync.Mutex
+	lease protocol.Lease
+	unit  primes.Strategy // Valid numbers of the current unit, nil before the first lease
+	found int             // Numbers yielded from the current unit
+	done  bool            // The server has no unit left or leasing failed
+}
+
+func newLeasedStrategy(c *client.Client, v primes.Validator, logger *slog.Logger) *leasedStrategy {
+	return &leasedStrategy{c: c, validator: v, logger: logger}
+}
+
+func (s *leasedStrategy) Next() (int32, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.done {
+		if s.unit != nil {
+			if n, ok := s.unit.Next(); ok {
+				s.found++
+				return n, true
+			}
+			if err := s.c.Complete(s.lease.UnitID, s.found); err != nil {
+				s.logger.Warn("completing work unit", "unit", s.lease.UnitID, "err", err)
+			} else {
+				s.logger.Info("work unit completed", "unit", s.lease.UnitID, "found", s.found)
+			}
+		}
+
+		lease, ok, err := s.c.Lease()
+		if err != nil {
+			s.logger.Warn("leasing work unit", "err", err)
+			s.done = true
+		} else if !ok {
+			s.logger.Info("server has no work unit left")
+			s.done = true
+		} else {
+			s.lease, s.unit, s.found = lease, primes.Matching(primes.NewSieve(lease.Range.Lo, lease.Range.Hi), s.validator), 0
+			s.logger.Info("work unit leased", "unit", lease.UnitID, "lo", lease.Range.Lo, "hi", lease.Range.Hi)
+		}
+	}
+	return 0, false
+}
+
+// Generates, signs and submits primes on the connection until the room is done, the connection fails or stop is closed.
+// Once the strategy runs out of numbers the worker falls back to random ones valid for the rule.
+func runWorker(c *client.Client, gen primes.Strategy, v primes.Validator, rng *rand.Rand, batch int, logger *slog.Logger, stats *workerStats, stop <-chan struct{}) {
+	start := time.Now()
+	defer func() { stats.Elapsed = time.Since(start) }()
+	rule := v.String()
+
+	nums := make([]int32, 0, batch)
+	for {
+		if stopped(stop) {
+			return
+		}
+
+		nums = nums[:0]
+		for len(nums) < batch {
+			num, ok := gen.Next()
+			if !ok {
+				logger.Info("no numbers left in the worker's range, switching to random ones")
+				gen = primes.RandomFor(v, rng)
+				num, _ = gen.Next()
+			}
+			nums = append(nums, num)
+		}
+		logger.Debug("sending numbers", "numbers", nums)
+
+		var responses []int32
+		var err error
+		if batch == 1 {
+			var response int32
+			response, err = c.Submit(nums[0])
+			responses = []int32{response}
+		} else {
+			responses, err = c.SubmitBatch(nums)
+		}
+		if errors.Is(err, client.ErrRoomDone) || (err != nil && stopped(stop)) {
+			return // Another worker saw the end of the run, the server may have closed the connection
+		}
+		if client.IsRejected(err) {
+			logger.Error("server closed the connection", "err", err)
+			return
+		}
+		if err != nil {
+			logger.Error("submitting numbers", "numbers", nums, "err", err)
+			return
+		}
+		for i, response := range responses {
+			stats.Submitted++
+			if stats.record(nums[i], response, rule, logger) {
+				return
+			}
+		}
+	}
+}
+
+// Counts the server's response to a number, reports whether the server is done with the room
+func (stats *workerStats) record(num int32, response int32, rule string, logger *slog.Logger) bool {
+	if response == protocol.StatusDone {
+		stats.Accepted++
+		logger.Info("number accepted, completing collection", "number", num)
+		logger.Info("server has collected all numbers, exiting")
+		return true
+	} else if response == protocol.StatusShutdown {
+		stats.NotCounted++
+		logger.Info("server has collected all numbers, exiting")
+		return true
+	} else if response == protocol.StatusRoundComplete {
+		stats.Accepted++
+		logger.Info("number accepted, completing round", "number", num)
+	} else if response == protocol.StatusNewRound {
+		stats.NotCounted++
+		logger.Info("number not counted, new round started", "number", num)
+	} else if response == protocol.StatusAdded {
+		stats.Accepted++
+		logger.Info("number accepted", "number", num)
+	} else if response == protocol.StatusDuplicate {
+		stats.Duplicate++
+		logger.Info("number rejected as duplicate", "number", num)
+	} else if response == protocol.StatusInvalidSignature {
+		stats.Rejected++
+		logger.Warn("number rejected for invalid signature", "number", num)
+	} else if response == protocol.StatusInvalidNumber {
+		stats.Rejected++
+		logger.Warn("number rejected by rule", "number", num, "rule", rule)
+	}
+	return false
+}
+
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
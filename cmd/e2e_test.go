@@ -2,7 +2,6 @@ package main
 
 import (
 	"crypto/rsa"
-	"encoding/binary"
 	"math/rand"
 	"net"
 	"testing"
@@ -11,6 +10,7 @@ import (
 	"github.com/omersuve/go-parallel-sign/pkg/auth"
 	"github.com/omersuve/go-parallel-sign/pkg/pool"
 	"github.com/omersuve/go-parallel-sign/pkg/primes"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
 )
 
 // TestIntegration_ServerClient tests the full server-client interaction
@@ -46,22 +46,32 @@ func TestIntegration_ServerClient(t *testing.T) {
 
 		t.Logf("Server accepted client, assigned clientID: %d", clientID)
 
-		pubBytes := make([]byte, 4096)
-		n, err := conn.Read(pubBytes)
+		payload, err := protocol.ReadFrameOf(conn, protocol.FrameHello)
 		if err != nil {
-			t.Errorf("Server failed to read public key: %v", err)
+			t.Errorf("Server failed to read hello: %v", err)
+			return
+		}
+		var hello protocol.Hello
+		if err := protocol.DecodeJSON(payload, &hello); err != nil {
+			t.Errorf("Server failed to decode hello: %v", err)
 			return
 		}
 
-		t.Logf("Server received public key (%d bytes)", n)
+		t.Logf("Server received public key (%d bytes) for room %q", len(hello.PublicKey), hello.Room)
 
-		pubKey, err := auth.ParsePublicKey(pubBytes[:n])
+		pubKey, err := auth.ParsePublicKey(hello.PublicKey)
 		if err != nil {
 			t.Errorf("Server failed to parse public key: %v", err)
 			return
 		}
 		publicKeys[clientID] = pubKey
-		err = binary.Write(conn, binary.LittleEndian, clientID)
+		err = protocol.WriteJSON(conn, protocol.FrameWelcome, protocol.Welcome{
+			ClientID: clientID,
+			Room:     hello.Room,
+			Max:      maxNumbers,
+			Rule:     "prime",
+			Rounds:   1,
+		})
 		if err != nil {
 			t.Errorf("Server failed to send clientID: %v", err)
 			return
@@ -69,48 +79,43 @@ func TestIntegration_ServerClient(t *testing.T) {
 
 		t.Logf("Server sent clientID %d to client", clientID)
 
-		var num int32
-		sig := make([]byte, 256)
 		for p.Len() < maxNumbers {
-			err = binary.Read(conn, binary.LittleEndian, &num)
+			payload, err := protocol.ReadFrameOf(conn, protocol.FrameSubmit)
 			if err != nil {
-				t.Errorf("Server failed to read number: %v", err)
+				t.Errorf("Server failed to read submission: %v", err)
 				return
 			}
-
-			t.Logf("Server received number: %d", num)
-
-			n, err = conn.Read(sig)
+			num, sig, err := protocol.DecodeSubmit(payload)
 			if err != nil {
-				t.Errorf("Server failed to read signature: %v", err)
+				t.Errorf("Server failed to decode submission: %v", err)
 				return
 			}
 
-			t.Logf("Server received signature (%d bytes)", n)
+			t.Logf("Server received number: %d with signature (%d bytes)", num, len(sig))
 
-			if auth.Verify(num, sig[:n], pubKey) {
+			if auth.Verify(num, sig, pubKey) {
 				if p.Add(num, clientID) {
 
 					t.Logf("Server added %d to pool, length now: %d", num, p.Len())
 
-					binary.Write(conn, binary.LittleEndian, int32(1))
+					protocol.WriteResponse(conn, protocol.StatusAdded)
 				} else {
 
 					t.Logf("Server rejected %d (duplicate), pool length: %d", num, p.Len())
 
-					binary.Write(conn, binary.LittleEndian, int32(0))
+					protocol.WriteResponse(conn, protocol.StatusDuplicate)
 				}
 			} else {
 
 				t.Logf("Server rejected %d (invalid signature)", num)
 
-				binary.Write(conn, binary.LittleEndian, int32(-3))
+				protocol.WriteResponse(conn, protocol.StatusInvalidSignature)
 			}
 		}
 
 		t.Logf("Server collected %d numbers, sending shutdown signal (-1)", maxNumbers)
 
-		binary.Write(conn, binary.LittleEndian, int32(-1)) // Signal completion
+		protocol.WriteResponse(conn, protocol.StatusDone) // Signal completion
 	}()
 
 	// Wait for server to start
@@ -141,7 +146,7 @@ func TestIntegration_ServerClient(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Client failed to have bytes from public key: %v", err)
 	}
-	_, err = conn.Write(pubBytes)
+	err = protocol.WriteJSON(conn, protocol.FrameHello, protocol.Hello{Room: "default", PublicKey: pubBytes})
 	if err != nil {
 		t.Fatalf("Client failed to send public key: %v", err)
 	}
@@ -149,11 +154,15 @@ func TestIntegration_ServerClient(t *testing.T) {
 	t.Logf("Client sent public key (%d bytes)", len(pubBytes))
 
 	// Receive clientID
-	var clientID int32
-	err = binary.Read(conn, binary.LittleEndian, &clientID)
+	payload, err := protocol.ReadFrameOf(conn, protocol.FrameWelcome)
 	if err != nil {
-		t.Fatalf("Client failed to read clientID: %v", err)
+		t.Fatalf("Client failed to read welcome: %v", err)
+	}
+	var welcome protocol.Welcome
+	if err := protocol.DecodeJSON(payload, &welcome); err != nil {
+		t.Fatalf("Client failed to decode welcome: %v", err)
 	}
+	clientID := welcome.ClientID
 
 	t.Logf("Client received clientID: %d", clientID)
 
@@ -173,20 +182,19 @@ func TestIntegration_ServerClient(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Client failed to sign %d: %v", num, err)
 		}
-		err = binary.Write(conn, binary.LittleEndian, num)
+		err = protocol.WriteSubmit(conn, num, sig)
 		if err != nil {
 			t.Fatalf("Client failed to send %d: %v", num, err)
 		}
-		_, err = conn.Write(sig)
-		if err != nil {
-			t.Fatalf("Client failed to send signature for %d: %v", num, err)
-		}
 
-		var response int32
-		err = binary.Read(conn, binary.LittleEndian, &response)
+		payload, err := protocol.ReadFrameOf(conn, protocol.FrameResponse)
 		if err != nil {
 			t.Fatalf("Client failed to read response: %v", err)
 		}
+		response, err := protocol.DecodeResponse(payload)
+		if err != nil {
+			t.Fatalf("Client failed to decode response: %v", err)
+		}
 
 		t.Logf("Client received response %d for prime %d", response, num)
 
@@ -200,8 +208,11 @@ func TestIntegration_ServerClient(t *testing.T) {
 	}
 
 	// Verify completion
-	var finalResponse int32
-	binary.Read(conn, binary.LittleEndian, &finalResponse)
+	payload, err = protocol.ReadFrameOf(conn, protocol.FrameResponse)
+	if err != nil {
+		t.Fatalf("Client failed to read final response: %v", err)
+	}
+	finalResponse, _ := protocol.DecodeResponse(payload)
 
 	t.Logf("Client received final response: %d", finalResponse)
 
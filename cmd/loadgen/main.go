@@ -0,0 +1,200 @@
+// Command loadgen runs many in-process clients against a server and reports throughput, latency and time to fill.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/client"
+	"github.com/omersuve/go-parallel-sign/pkg/logging"
+	"github.com/omersuve/go-parallel-sign/pkg/primes"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Load profile shared by every simulated client
+type profile struct {
+	Rate       float64 // Submissions per second per client, unlimited if zero
+	Duplicates float64 // Fraction of submissions resending an already accepted number
+	Invalid    float64 // Fraction of submissions with a corrupted signature
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:3000", "server address")
+	roomName := flag.String("room", "default", "name of the room to join")
+	numClients := flag.Int("clients", 10, "number of simulated clients, each with its own connection and key")
+	keyAlgorithm := flag.String("key", "rsa", "key algorithm of the clients (rsa, ed25519)")
+	rate := flag.Float64("rate", 0, "submissions per second per client (0 for as fast as possible)")
+	duplicates := flag.Float64("duplicates", 0, "fraction of submissions resending an already accepted number")
+	invalid := flag.Float64("invalid", 0, "fraction of submissions with an invalid signature")
+	seedFlag := flag.Uint64("seed", 0, "seed of the simulated clients' random generators, to replay a load profile (0 draws one from crypto/rand)")
+	duration := flag.Duration("duration", 0, "stop after this long even if the room is not full (0 waits for the room to fill)")
+	logLevel := flag.String("log-level", "warn", "log level (debug, info, warn, error)")
+	logFormat := flag.String("log-format", "text", "log format (text, json)")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, logging.Options{Level: *logLevel, Format: *logFormat, Sample: 100})
+	if err != nil {
+		fmt.Println("Error configuring logging:", err)
+		return
+	}
+	slog.SetDefault(logger)
+
+	algorithm, err := auth.ParseAlgorithm(*keyAlgorithm)
+	if err != nil {
+		slog.Error("invalid -key", "err", err)
+		return
+	}
+	if *numClients < 1 || *duplicates < 0 || *invalid < 0 || *duplicates+*invalid > 1 {
+		slog.Error("invalid load profile, need at least one client and duplicates + invalid <= 1")
+		return
+	}
+	prof := profile{Rate: *rate, Duplicates: *duplicates, Invalid: *invalid}
+	seed := primes.Seed(*seedFlag)
+	if seed == 0 {
+		if seed, err = primes.NewSeed(); err != nil {
+			slog.Error("drawing a random seed", "err", err)
+			return
+		}
+	}
+
+	// Keys are generated up front so that key generation does not count against the server
+	keys := make([]*auth.KeyPair, *numClients)
+	for i := range keys {
+		if keys[i], err = auth.GenerateKeyPair(algorithm); err != nil {
+			slog.Error("generating keys", "err", err)
+			return
+		}
+	}
+
+	clients := make([]*client.Client, 0, *numClients)
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+	for _, k := range keys {
+		c, err := client.Dial(client.Config{Addr: *addr, Room: *roomName, Keys: k})
+		if err != nil {
+			slog.Error("joining room", "err", err)
+			return
+		}
+		clients = append(clients, c)
+	}
+	welcome := clients[0].Welcome()
+	fmt.Printf("%d %s clients joined room %s (max %d, rule %s)\n", len(clients), algorithm, welcome.Room, welcome.Max, welcome.Rule)
+
+	// Fresh numbers are valid for the rule the server announced
+	validator, err := primes.ParseValidator(welcome.Rule)
+	if err != nil {
+		slog.Warn("unknown rule, submitting primes", "err", err)
+		validator, _ = primes.ParseValidator("prime")
+	}
+
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopAll := func() { stopOnce.Do(func() { close(stop) }) }
+	if *duration > 0 {
+		time.AfterFunc(*duration, stopAll)
+	}
+
+	results := make([]*clientResult, len(clients))
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		results[i] = newClientResult()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := seed.Rand(i)
+			simulate(c, primes.RandomFor(validator, rng), rng, prof, results[i], stop)
+			if !results[i].filled.IsZero() {
+				stopAll() // The room is done, clients that did not hear of it yet would only get errors
+			}
+		}()
+	}
+	wg.Wait()
+
+	printReport(mergeResults(results), seed, start, time.Now())
+}
+
+// Submits numbers following the profile until the room is done, the connection fails or stop is closed
+func simulate(c *client.Client, gen primes.Strategy, rng *rand.Rand, prof profile, res *clientResult, stop <-chan struct{}) {
+	var accepted []int32
+
+	var tick <-chan time.Time
+	if prof.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / prof.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		if tick != nil {
+			select {
+			case <-stop:
+				return
+			case <-tick:
+			}
+		} else {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+
+		// Pick the kind of submission, duplicates need an accepted number to resend
+		kind := kindFresh
+		switch p := rng.Float64(); {
+		case p < prof.Invalid:
+			kind = kindInvalid
+		case p < prof.Invalid+prof.Duplicates && len(accepted) > 0:
+			kind = kindDuplicate
+		}
+
+		var num int32
+		if kind == kindDuplicate {
+			num = accepted[rng.Intn(len(accepted))]
+		} else {
+			num, _ = gen.Next()
+		}
+		sig, err := c.Keys().Sign(num)
+		if err != nil {
+			slog.Error("signing number", "client_id", c.ID(), "err", err)
+			return
+		}
+		if kind == kindInvalid {
+			sig[0] ^= 0xff
+		}
+
+		sent := time.Now()
+		status, err := c.SubmitSigned(num, sig)
+		latency := time.Since(sent)
+		if err != nil {
+			select {
+			case <-stop: // The server may close connections once the room is done
+			default:
+				slog.Warn("submitting number", "client_id", c.ID(), "err", err)
+				res.errors++
+			}
+			return
+		}
+		res.record(kind, status, latency)
+
+		switch status {
+		case protocol.StatusAdded:
+			accepted = append(accepted, num)
+		case protocol.StatusRoundComplete, protocol.StatusNewRound:
+			accepted = accepted[:0] // The pool was reset, old numbers are no longer duplicates
+		case protocol.StatusDone, protocol.StatusShutdown:
+			res.filled = time.Now()
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/primes"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Kind of a simulated submission
+type submissionKind int
+
+const (
+	kindFresh     submissionKind = iota // New random prime
+	kindDuplicate                       // Number the client already had accepted
+	kindInvalid                         // Corrupted signature
+)
+
+var kindNames = [...]string{"fresh", "duplicate", "invalid"}
+
+var statusNames = map[int32]string{
+	protocol.StatusAdded:            "added",
+	protocol.StatusDuplicate:        "duplicate",
+	protocol.StatusDone:             "done",
+	protocol.StatusShutdown:         "shutdown",
+	protocol.StatusInvalidSignature: "invalid signature",
+	protocol.StatusRoundComplete:    "round complete",
+	protocol.StatusNewRound:         "new round",
+	protocol.StatusInvalidNumber:    "invalid number",
+	protocol.StatusPaused:           "paused",
+}
+
+// What a simulated client observed
+type clientResult struct {
+	sent      [len(kindNames)]int
+	statuses  map[int32]int
+	latencies []time.Duration // Submission round trips, slow down retries included
+	errors    int
+	filled    time.Time // When the client learned that the room is done, zero if it did not
+}
+
+func newClientResult() *clientResult {
+	return &clientResult{statuses: make(map[int32]int)}
+}
+
+func (r *clientResult) record(kind submissionKind, status int32, latency time.Duration) {
+	r.sent[kind]++
+	r.statuses[status]++
+	r.latencies = append(r.latencies, latency)
+}
+
+func mergeResults(results []*clientResult) *clientResult {
+	total := newClientResult()
+	for _, r := range results {
+		for kind, n := range r.sent {
+			total.sent[kind] += n
+		}
+		for status, n := range r.statuses {
+			total.statuses[status] += n
+		}
+		total.latencies = append(total.latencies, r.latencies...)
+		total.errors += r.errors
+		if !r.filled.IsZero() && (total.filled.IsZero() || r.filled.Before(total.filled)) {
+			total.filled = r.filled
+		}
+	}
+	return total
+}
+
+// Value below which the fraction p of the sorted durations fall
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func printReport(res *clientResult, seed primes.Seed, start, end time.Time) {
+	elapsed := end.Sub(start)
+	submissions := len(res.latencies)
+	accepted := res.statuses[protocol.StatusAdded] + res.statuses[protocol.StatusRoundComplete] + res.statuses[protocol.StatusDone]
+
+	fmt.Println("---LOAD TEST---")
+	fmt.Printf("Seed: %d\n", uint64(seed))
+	fmt.Printf("Duration: %v\n", elapsed.Round(time.Millisecond))
+	if res.filled.IsZero() {
+		fmt.Println("Time to fill: room not filled")
+	} else {
+		fmt.Printf("Time to fill: %v\n", res.filled.Sub(start).Round(time.Millisecond))
+	}
+	fmt.Printf("Submissions: %d (%.1f/s), accepted: %d (%.1f/s), errors: %d\n",
+		submissions, float64(submissions)/elapsed.Seconds(), accepted, float64(accepted)/elapsed.Seconds(), res.errors)
+	for kind, n := range res.sent {
+		fmt.Printf("Sent %s: %d\n", kindNames[kind], n)
+	}
+
+	statuses := make([]int32, 0, len(res.statuses))
+	for status := range res.statuses {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+	for _, status := range statuses {
+		name, ok := statusNames[status]
+		if !ok {
+			name = fmt.Sprintf("status %d", status)
+		}
+		fmt.Printf("Response %s: %d\n", name, res.statuses[status])
+	}
+
+	slices.Sort(res.latencies)
+	fmt.Printf("Latency p50: %v, p90: %v, p99: %v, max: %v\n",
+		percentile(res.latencies, 0.50), percentile(res.latencies, 0.90), percentile(res.latencies, 0.99), percentile(res.latencies, 1))
+}
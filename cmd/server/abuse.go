@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+	"github.com/omersuve/go-parallel-sign/pkg/ratelimit"
+)
+
+// Thresholds on invalid signatures per connection, zero values disable the matching action
+type abuseConfig struct {
+	Throttle     int           `json:"throttle"`      // Invalid signatures after which submissions are throttled
+	ThrottleRate float64       `json:"throttle_rate"` // Submissions per second allowed once throttled
+	Disconnect   int           `json:"disconnect"`    // Invalid signatures after which the client is disconnected
+	Ban          time.Duration `json:"ban"`           // How long the key of a disconnected client is banned
+	Penalty      int           `json:"penalty"`       // Points deducted from the score of a disconnected client
+}
+
+// Encodes the ban duration as a string such as "1h0m0s" rather than nanoseconds
+func (a abuseConfig) MarshalJSON() ([]byte, error) {
+	type plain abuseConfig
+	return json.Marshal(struct {
+		plain
+		Ban string `json:"ban"`
+	}{plain(a), a.Ban.String()})
+}
+
+var abuse abuseConfig
+
+// Action to take after an invalid signature
+type abuseAction int
+
+const (
+	abuseNone abuseAction = iota
+	abuseThrottle
+	abuseDisconnect
+)
+
+// Counts the invalid signatures of a connection
+type abuseTracker struct {
+	invalid  int
+	throttle *ratelimit.Bucket // Set once the client is throttled
+}
+
+// Records an invalid signature and returns the action it triggers
+func (a *abuseTracker) recordInvalid() abuseAction {
+	a.invalid++
+	if abuse.Disconnect > 0 && a.invalid >= abuse.Disconnect {
+		return abuseDisconnect
+	}
+	if abuse.Throttle > 0 && a.invalid == abuse.Throttle {
+		a.throttle = ratelimit.NewBucket(abuse.ThrottleRate, 1)
+		return abuseThrottle
+	}
+	return abuseNone
+}
+
+// Reports whether a throttled client may submit now, always true for other clients
+func (a *abuseTracker) allow() bool {
+	return a.throttle == nil || a.throttle.Allow()
+}
+
+// Disconnects an abusive client, bans its key and deducts the penalty from its score as configured
+func punishClient(r *room, clientID int32, fingerprint string, w io.Writer, logger *slog.Logger) {
+	if abuse.Ban > 0 {
+		bans.Ban(fingerprint, abuse.Ban)
+		abuseActions.Inc("ban")
+	}
+	if abuse.Penalty > 0 {
+		r.pool.Deduct(clientID, abuse.Penalty)
+		r.penalize(clientID, abuse.Penalty)
+		abuseActions.Inc("penalty")
+	}
+	abuseActions.Inc("disconnect")
+	logger.Warn("disconnecting client for invalid signatures", "ban", abuse.Ban, "penalty", abuse.Penalty)
+
+	err := protocol.WriteJSON(w, protocol.FrameError, protocol.Error{Message: "too many invalid signatures"})
+	if err != nil {
+		logger.Warn("sending disconnect reason", "err", err)
+	}
+}
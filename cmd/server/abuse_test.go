@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Applies the abuse thresholds for the duration of the test
+func setAbuse(t *testing.T, cfg abuseConfig) {
+	t.Helper()
+	saved, savedBans := abuse, bans
+	abuse, bans = cfg, newBanList()
+	t.Cleanup(func() { abuse, bans = saved, savedBans })
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestAbuseTrackerThresholds(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  abuseConfig
+		want []abuseAction // Action after each invalid signature
+	}{
+		{"disabled", abuseConfig{}, []abuseAction{abuseNone, abuseNone, abuseNone}},
+		{"throttle only", abuseConfig{Throttle: 2, ThrottleRate: 1}, []abuseAction{abuseNone, abuseThrottle, abuseNone, abuseNone}},
+		{"disconnect only", abuseConfig{Disconnect: 2}, []abuseAction{abuseNone, abuseDisconnect, abuseDisconnect}},
+		{"throttle then disconnect", abuseConfig{Throttle: 2, ThrottleRate: 1, Disconnect: 4},
+			[]abuseAction{abuseNone, abuseThrottle, abuseNone, abuseDisconnect}},
+		{"disconnect before throttle", abuseConfig{Throttle: 3, ThrottleRate: 1, Disconnect: 2}, []abuseAction{abuseNone, abuseDisconnect}},
+	} {
+		setAbuse(t, tt.cfg)
+		var tracker abuseTracker
+		for i, want := range tt.want {
+			if got := tracker.recordInvalid(); got != want {
+				t.Errorf("%s: invalid signature %d triggered %d, want %d", tt.name, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestAbuseTrackerThrottles(t *testing.T) {
+	setAbuse(t, abuseConfig{Throttle: 1, ThrottleRate: 0.001})
+	var tracker abuseTracker
+	if !tracker.allow() || !tracker.allow() {
+		t.Errorf("allow() = false before any invalid signature, want true")
+	}
+	tracker.recordInvalid()
+	if !tracker.allow() {
+		t.Errorf("allow() = false right after throttling, want the burst of one submission")
+	}
+	if tracker.allow() {
+		t.Errorf("allow() = true twice while throttled, want false")
+	}
+}
+
+func TestPunishClient(t *testing.T) {
+	setAbuse(t, abuseConfig{Disconnect: 1, Ban: time.Hour, Penalty: 3})
+	r := newTestRoom(t, "abuse", 10, 1)
+	r.pool.Add(2, 7)
+	r.pool.Add(3, 7)
+	var out bytes.Buffer
+	punishClient(r, 7, "fingerprint", &out, discardLogger)
+
+	if !bans.IsBanned("fingerprint") {
+		t.Errorf("key not banned after punishClient()")
+	}
+	if score := r.pool.GetScoreboard()[7]; score != -1 {
+		t.Errorf("score after a penalty of 3 on 2 numbers = %d, want -1", score)
+	}
+	if penalty := r.Stats()[7].Penalty; penalty != 3 {
+		t.Errorf("recorded penalty = %d, want 3", penalty)
+	}
+	frameType, _, err := protocol.ReadFrame(&out)
+	if err != nil || frameType != protocol.FrameError {
+		t.Errorf("punishClient() sent frame %d (%v), want an error frame", frameType, err)
+	}
+}
+
+func TestPunishClientDisabledActions(t *testing.T) {
+	setAbuse(t, abuseConfig{Disconnect: 1})
+	r := newTestRoom(t, "abuse", 10, 1)
+	r.pool.Add(2, 7)
+	punishClient(r, 7, "fingerprint", io.Discard, discardLogger)
+	if bans.IsBanned("fingerprint") || r.pool.GetScoreboard()[7] != 1 {
+		t.Errorf("punishClient() banned the key or changed the score without -abuse-ban or -abuse-penalty")
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// State of a room as shown in the admin view
+type roomState struct {
+	Name       string        `json:"name"`
+	Max        int           `json:"max"`
+	Rule       string        `json:"rule"`
+	PoolLength int           `json:"pool_length"`
+	Round      int           `json:"round"`
+	Rounds     int           `json:"rounds"`
+	Paused     bool          `json:"paused"`
+	Done       bool          `json:"done"`
+	Clients    int           `json:"clients"` // Active clients
+	Scoreboard map[int32]int `json:"scoreboard"`
+	Standings  map[int32]int `json:"standings"`
+}
+
+func newRoomState(r *room) roomState {
+	return roomState{
+		Name:       r.name,
+		Max:        r.pool.Max(),
+		Rule:       r.rule,
+		PoolLength: r.pool.Len(),
+		Round:      r.rounds.Current(),
+		Rounds:     r.rounds.total,
+		Paused:     r.paused.Load(),
+		Done:       r.isDone(),
+		Clients:    len(connections.Active(r)),
+		Scoreboard: r.pool.GetScoreboard(),
+		Standings:  r.rounds.Standings(),
+	}
+}
+
+// Serves the admin API on addr, every request must carry the token as a bearer token
+func serveAdmin(addr, token string) {
+	slog.Info("serving admin API", "url", "http://"+addr)
+	if err := http.ListenAndServe(addr, adminHandler(token)); err != nil {
+		slog.Error("serving admin API", "err", err)
+	}
+}
+
+// Routes of the admin API behind the token check
+func adminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rooms", adminListRooms)
+	mux.HandleFunc("GET /rooms/{name}", adminGetRoom)
+	mux.HandleFunc("GET /rooms/{name}/units", adminListUnits)
+	mux.HandleFunc("PUT /rooms/{name}/max", adminSetMax)
+	mux.HandleFunc("POST /rooms/{name}/pause", adminPause)
+	mux.HandleFunc("POST /rooms/{name}/resume", adminResume)
+	mux.HandleFunc("POST /rooms/{name}/end-round", adminEndRound)
+	mux.HandleFunc("POST /rooms/{name}/announce", adminAnnounce)
+	mux.HandleFunc("POST /announce", adminAnnounce)
+	mux.HandleFunc("GET /clients", adminListClients)
+	mux.HandleFunc("DELETE /clients/{id}", adminKickClient)
+	mux.HandleFunc("GET /bans", adminListBans)
+	mux.HandleFunc("POST /bans", adminBan)
+	mux.HandleFunc("DELETE /bans/{fingerprint}", adminUnban)
+	return requireToken(token, mux)
+}
+
+// Binds to localhost unless a host is given explicitly
+func adminListenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// Generates a random token, for the admin API when none is configured and for resume tokens
+func generateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got := []byte(req.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Looks up the room named in the path, writes a 404 if there is none
+func lookupRoom(w http.ResponseWriter, req *http.Request) (*room, bool) {
+	r, ok := rooms[req.PathValue("name")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown room")
+	}
+	return r, ok
+}
+
+func adminListRooms(w http.ResponseWriter, _ *http.Request) {
+	states := make([]roomState, 0, len(rooms))
+	for _, r := range rooms {
+		states = append(states, newRoomState(r))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	writeJSON(w, http.StatusOK, states)
+}
+
+func adminGetRoom(w http.ResponseWriter, req *http.Request) {
+	if r, ok := lookupRoom(w, req); ok {
+		writeJSON(w, http.StatusOK, newRoomState(r))
+	}
+}
+
+func adminListUnits(w http.ResponseWriter, req *http.Request) {
+	if r, ok := lookupRoom(w, req); ok {
+		writeJSON(w, http.StatusOK, r.work.Progress())
+	}
+}
+
+func adminSetMax(w http.ResponseWriter, req *http.Request) {
+	r, ok := lookupRoom(w, req)
+	if !ok {
+		return
+	}
+	var body struct {
+		Max int `json:"max"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if !r.pool.SetMax(body.Max) {
+		writeError(w, http.StatusConflict, "max must be above the current pool length")
+		return
+	}
+	slog.Info("admin changed max", "room", r.name, "max", body.Max)
+	recordPoolFill(r)
+	writeJSON(w, http.StatusOK, newRoomState(r))
+}
+
+func adminPause(w http.ResponseWriter, req *http.Request) {
+	if r, ok := lookupRoom(w, req); ok {
+		r.paused.Store(true)
+		slog.Info("admin paused room", "room", r.name)
+		writeJSON(w, http.StatusOK, newRoomState(r))
+	}
+}
+
+func adminResume(w http.ResponseWriter, req *http.Request) {
+	if r, ok := lookupRoom(w, req); ok {
+		r.paused.Store(false)
+		slog.Info("admin resumed room", "room", r.name)
+		writeJSON(w, http.StatusOK, newRoomState(r))
+	}
+}
+
+// Ends the current round of the room as if its pool was full
+func adminEndRound(w http.ResponseWriter, req *http.Request) {
+	r, ok := lookupRoom(w, req)
+	if !ok {
+		return
+	}
+	res, last, ok := r.rounds.Finish(r.pool, r.rounds.Current())
+	if !ok {
+		writeError(w, http.StatusConflict, "room is already finished")
+		return
+	}
+	slog.Info("admin ended round", "room", r.name, "round", res.Round)
+	if r.rounds.total > 1 {
+		printRoundResult(r.name, res, r.rounds.total)
+	}
+	announceRoundResult(r, res)
+	if last {
+		writeJSON(w, http.StatusOK, newRoomState(r))
+		// Let the response go out before the server possibly exits
+		go notifyClientsAndFinishRoom(r, nil)
+		return
+	}
+	recordPoolFill(r)
+	writeJSON(w, http.StatusOK, newRoomState(r))
+}
+
+// Sends a message to the clients of the room in the path, or of every room
+func adminAnnounce(w http.ResponseWriter, req *http.Request) {
+	var r *room
+	if req.PathValue("name") != "" {
+		var ok bool
+		if r, ok = lookupRoom(w, req); !ok {
+			return
+		}
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Message == "" {
+		writeError(w, http.StatusBadRequest, "body must be a JSON object with a message")
+		return
+	}
+	a := protocol.Announcement{Kind: protocol.AnnounceMessage, Message: body.Message}
+	if r != nil {
+		a.Room = r.name
+	}
+	announce(r, a)
+	slog.Info("admin sent announcement", "room", a.Room, "message", body.Message)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminListClients(w http.ResponseWriter, _ *http.Request) {
+	list := []clientInfo{}
+	for _, c := range connections.List() {
+		list = append(list, c.info())
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Looks up the connected client named in the path, writes an error if there is none
+func lookupClient(w http.ResponseWriter, id string) (*clientConn, bool) {
+	clientID, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid client ID")
+		return nil, false
+	}
+	c, ok := connections.Get(int32(clientID))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown client")
+	}
+	return c, ok
+}
+
+// Disconnects the client with a reason, so that it does not reconnect, and forgets its session so that
+// its resume token stops working and its work unit can be reassigned. Its handler cleans up once the read fails.
+func adminKickClient(w http.ResponseWriter, req *http.Request) {
+	c, ok := lookupClient(w, req.PathValue("id"))
+	if !ok {
+		return
+	}
+	slog.Info("admin kicked client", "client_id", c.ID())
+	if sess := c.Session(); sess != nil {
+		sessions.Delete(sess)
+	}
+	protocol.WriteJSON(c, protocol.FrameError, protocol.Error{Message: "kicked by the server"})
+	c.closeOutbound()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminListBans(w http.ResponseWriter, _ *http.Request) {
+	list := bans.List()
+	sort.Slice(list, func(i, j int) bool { return list[i].Fingerprint < list[j].Fingerprint })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Bans a key given by fingerprint or by the connected client using it, and kicks the clients using it
+func adminBan(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		ClientID    int32  `json:"client_id"`
+		Fingerprint string `json:"fingerprint"`
+		Duration    string `json:"duration"` // Permanent if empty
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	var duration time.Duration
+	if body.Duration != "" {
+		d, err := time.ParseDuration(body.Duration)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid duration")
+			return
+		}
+		duration = d
+	}
+	fingerprint := body.Fingerprint
+	if fingerprint == "" {
+		c, ok := lookupClient(w, strconv.Itoa(int(body.ClientID)))
+		if !ok {
+			return
+		}
+		fingerprint = c.Fingerprint()
+		if fingerprint == "" {
+			writeError(w, http.StatusConflict, "client has not completed the handshake")
+			return
+		}
+	}
+
+	bans.Ban(fingerprint, duration)
+	slog.Info("admin banned key", "key_fingerprint", fingerprint, "duration", duration)
+
+	for _, c := range connections.List() {
+		if c.Fingerprint() == fingerprint {
+			protocol.WriteJSON(c, protocol.FrameError, protocol.Error{Message: "key is banned"})
+			c.closeOutbound()
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminUnban(w http.ResponseWriter, req *http.Request) {
+	if !bans.Unban(req.PathValue("fingerprint")) {
+		writeError(w, http.StatusNotFound, "key is not banned")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Replaces the server's rooms for the duration of the test
+func setRooms(t *testing.T, testRooms ...*room) {
+	t.Helper()
+	saved := rooms
+	rooms = make(map[string]*room)
+	for _, r := range testRooms {
+		rooms[r.name] = r
+	}
+	t.Cleanup(func() { rooms = saved })
+}
+
+// Serves the admin API over the given rooms for the duration of the test
+func startAdmin(t *testing.T, testRooms ...*room) *httptest.Server {
+	t.Helper()
+	setRooms(t, testRooms...)
+	srv := httptest.NewServer(adminHandler("secret"))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestRoom(t *testing.T, name string, max, numRounds int) *room {
+	t.Helper()
+	r, err := newRoom(name, max, "prime", numRounds, time.Now())
+	if err != nil {
+		t.Fatalf("newRoom(%q) failed: %v", name, err)
+	}
+	return r
+}
+
+// Runs handleClient on one end of a pipe and joins with the hello on the other end. done is closed once
+// the handler returned, the client end is closed when the test ends.
+func joinTestClient(t *testing.T, hello protocol.Hello) (welcome protocol.Welcome, conn net.Conn, done <-chan struct{}) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	handled := make(chan struct{})
+	go func() {
+		handleClient(connections.Register(serverConn))
+		close(handled)
+	}()
+	t.Cleanup(func() {
+		clientConn.Close()
+		<-handled
+	})
+
+	protocol.WriteJSON(clientConn, protocol.FrameHello, hello)
+	payload, err := protocol.ReadFrameOf(clientConn, protocol.FrameWelcome)
+	if err != nil {
+		t.Fatalf("reading welcome failed: %v", err)
+	}
+	if err := protocol.DecodeJSON(payload, &welcome); err != nil {
+		t.Fatalf("decoding welcome failed: %v", err)
+	}
+	return welcome, clientConn, handled
+}
+
+func adminRequest(t *testing.T, srv *httptest.Server, method, path, token, body string) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAdminAPI(t *testing.T) {
+	open := newTestRoom(t, "open", 3, 1)
+	open.pool.Add(2, 1)
+	open.pool.Add(3, 1)
+	finished := newTestRoom(t, "finished", 1, 1)
+	finished.rounds.Finish(finished.pool, 1)
+	srv := startAdmin(t, open, finished)
+
+	for _, tt := range []struct {
+		name         string
+		method, path string
+		token, body  string
+		want         int
+	}{
+		{"no token", "GET", "/rooms", "", "", http.StatusUnauthorized},
+		{"wrong token", "GET", "/rooms", "guess", "", http.StatusUnauthorized},
+		{"list rooms", "GET", "/rooms", "secret", "", http.StatusOK},
+		{"unknown room", "GET", "/rooms/missing", "secret", "", http.StatusNotFound},
+		{"max below the pool length", "PUT", "/rooms/open/max", "secret", `{"max": 2}`, http.StatusConflict},
+		{"max above the pool length", "PUT", "/rooms/open/max", "secret", `{"max": 5}`, http.StatusOK},
+		{"invalid max body", "PUT", "/rooms/open/max", "secret", `max`, http.StatusBadRequest},
+		{"pause", "POST", "/rooms/open/pause", "secret", "", http.StatusOK},
+		{"end round of a finished room", "POST", "/rooms/finished/end-round", "secret", "", http.StatusConflict},
+	} {
+		if got := adminRequest(t, srv, tt.method, tt.path, tt.token, tt.body); got != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, got, tt.want)
+		}
+	}
+	if open.pool.Max() != 5 || !open.paused.Load() {
+		t.Errorf("room has max %d and paused %v, want 5 and true", open.pool.Max(), open.paused.Load())
+	}
+}
+
+func TestAdminKickedClientCannotResume(t *testing.T) {
+	setTimeouts(t, timeoutConfig{Resume: time.Minute})
+	r := newTestRoom(t, defaultRoom, 10, 1)
+	srv := startAdmin(t, r)
+	keys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	pub, _ := auth.PublicKey2Bytes(keys.PublicKey())
+	welcome, conn, done := joinTestClient(t, protocol.Hello{Room: defaultRoom, PublicKey: pub, WantRange: true})
+	if welcome.ResumeToken == "" || welcome.UnitID == 0 {
+		t.Fatalf("welcome = %+v, want a resume token and a work unit", welcome)
+	}
+
+	path := fmt.Sprintf("/clients/%d", welcome.ClientID)
+	if got := adminRequest(t, srv, "DELETE", path, "secret", ""); got != http.StatusNoContent {
+		t.Fatalf("DELETE %s = %d, want %d", path, got, http.StatusNoContent)
+	}
+	if _, err := protocol.ReadFrameOf(conn, protocol.FrameError); err != nil {
+		t.Errorf("kicked client did not get an error frame: %v", err)
+	}
+	<-done
+	if state := r.work.Progress().Units[0].State; state != "abandoned" {
+		t.Errorf("unit of the kicked client is %s, want abandoned", state)
+	}
+
+	resumed, _, _ := joinTestClient(t, protocol.Hello{Room: defaultRoom, PublicKey: pub, ResumeToken: welcome.ResumeToken})
+	if resumed.Resumed || resumed.ClientID == welcome.ClientID {
+		t.Errorf("kicked client resumed as client %d, resumed %v, want a new client", resumed.ClientID, resumed.Resumed)
+	}
+}
+
+func TestAdminListenAddr(t *testing.T) {
+	for addr, want := range map[string]string{
+		":9200":          "127.0.0.1:9200",
+		"0.0.0.0:9200":   "0.0.0.0:9200",
+		"localhost:80":   "localhost:80",
+		"not an address": "not an address",
+	} {
+		if got := adminListenAddr(addr); got != want {
+			t.Errorf("adminListenAddr(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
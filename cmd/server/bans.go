@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// A banned key and when the ban ends
+type ban struct {
+	Fingerprint string    `json:"fingerprint"`
+	Until       time.Time `json:"until"` // Zero for a permanent ban
+}
+
+// Tracks banned public keys by fingerprint
+type banList struct {
+	mu   sync.Mutex
+	bans map[string]time.Time // Fingerprint -> end of the ban, zero for a permanent ban
+}
+
+func newBanList() *banList {
+	return &banList{bans: make(map[string]time.Time)}
+}
+
+// Bans the key for the given duration, permanently if the duration is zero
+func (b *banList) Ban(fingerprint string, duration time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var until time.Time
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+	b.bans[fingerprint] = until
+}
+
+// Lifts the ban of the key, reports whether it was banned
+func (b *banList) Unban(fingerprint string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.bans[fingerprint]
+	delete(b.bans, fingerprint)
+	return ok
+}
+
+// Reports whether the key is currently banned, expired bans are dropped
+func (b *banList) IsBanned(fingerprint string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until, ok := b.bans[fingerprint]
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && time.Now().After(until) {
+		delete(b.bans, fingerprint)
+		return false
+	}
+	return true
+}
+
+// Returns the active bans
+func (b *banList) List() []ban {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	list := make([]ban, 0, len(b.bans))
+	for fingerprint, until := range b.bans {
+		if !until.IsZero() && now.After(until) {
+			continue
+		}
+		list = append(list, ban{Fingerprint: fingerprint, Until: until})
+	}
+	return list
+}
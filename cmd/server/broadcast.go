@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Queues the frame written by write for every active client of the room, or of every room if r is nil,
+// except one. Clients whose queue is full are disconnected rather than slowing down the others.
+func broadcast(r *room, except *clientConn, write func(w io.Writer) error) {
+	for _, c := range connections.Active(r) {
+		if c == except {
+			continue
+		}
+		if err := write(c); err != nil {
+			slog.Warn("disconnecting client that cannot keep up with broadcasts", "client_id", c.ID(), "err", err)
+			c.conn.Close()
+		}
+	}
+}
+
+// Tells the clients of the room, except the one that finished it, that the room is done
+func broadcastShutdown(r *room, except *clientConn) {
+	broadcast(r, except, func(w io.Writer) error {
+		return protocol.WriteResponse(w, protocol.StatusShutdown)
+	})
+}
+
+// Sends the results of a finished round to the clients of the room
+func announceRoundResult(r *room, res roundResult) {
+	announce(r, protocol.Announcement{
+		Kind:       protocol.AnnounceRoundResult,
+		Room:       r.name,
+		Round:      res.Round,
+		Scoreboard: res.Scoreboard,
+	})
+}
+
+// Sends an announcement to the clients of the room, or of every room if r is nil
+func announce(r *room, a protocol.Announcement) {
+	broadcast(r, nil, func(w io.Writer) error {
+		return protocol.WriteJSON(w, protocol.FrameAnnouncement, a)
+	})
+}
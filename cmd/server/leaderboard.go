@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Clients listed in full on every leaderboard, subscribers outside of it also get their own entry
+const leaderboardTop = 10
+
+// Sends every room's leaderboard to its subscribed clients each interval, until the server exits
+func streamLeaderboards(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, r := range rooms {
+			if !r.isDone() {
+				sendLeaderboard(r)
+			}
+		}
+	}
+}
+
+func sendLeaderboard(r *room) {
+	var subscribers []*clientConn
+	for _, c := range connections.Active(r) {
+		if c.subscribed.Load() {
+			subscribers = append(subscribers, c)
+		}
+	}
+	if len(subscribers) == 0 {
+		return
+	}
+
+	ranking := rankStats(r.Stats())
+	entries := make(map[int32]protocol.LeaderboardEntry, len(ranking))
+	lb := protocol.Leaderboard{
+		Room:       r.name,
+		Round:      r.rounds.Current(),
+		PoolLength: r.pool.Len(),
+		Max:        r.pool.Max(),
+		Clients:    len(ranking),
+	}
+	for _, e := range ranking {
+		entry := protocol.LeaderboardEntry{
+			ClientID:  e.ClientID,
+			Rank:      e.Rank,
+			Score:     e.score(),
+			Accepted:  e.Accepted,
+			Duplicate: e.Duplicate,
+			Invalid:   e.InvalidSignature + e.InvalidNumber,
+		}
+		entries[e.ClientID] = entry
+		if len(lb.Top) < leaderboardTop {
+			lb.Top = append(lb.Top, entry)
+		}
+	}
+
+	for _, c := range subscribers {
+		lb.You = nil
+		if entry, ok := entries[c.ID()]; ok {
+			lb.You = &entry
+		}
+		// Leaderboards are best effort, they must not crowd out the responses of a client that is behind
+		if c.backlog() >= outboundQueueSize/2 {
+			continue
+		}
+		if err := protocol.WriteJSON(c, protocol.FrameLeaderboard, lb); err != nil {
+			slog.Debug("sending leaderboard", "client_id", c.ID(), "err", err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/omersuve/go-parallel-sign/pkg/ratelimit"
+)
+
+// Connection and rate limits, zero values mean unlimited
+type limitConfig struct {
+	MaxConns       int     `json:"max_conns"`
+	Rate           float64 `json:"rate"`
+	Burst          int     `json:"burst"`
+	HandshakeRate  float64 `json:"handshake_rate"`
+	HandshakeBurst int     `json:"handshake_burst"`
+}
+
+var limits limitConfig
+var activeConns atomic.Int64          // Connections currently handled
+var handshakeLimiter *ratelimit.Keyed // Remote host -> handshake bucket, nil if unlimited
+
+// Applies the limits, must be called before accepting connections
+func setupLimits(cfg limitConfig) {
+	limits = cfg
+	if cfg.HandshakeRate > 0 {
+		handshakeLimiter = ratelimit.NewKeyed(cfg.HandshakeRate, cfg.HandshakeBurst)
+	}
+}
+
+// Reserves a connection slot, fails if the server is at capacity
+func acquireConn() bool {
+	if limits.MaxConns <= 0 {
+		activeConns.Add(1)
+		return true
+	}
+	for {
+		n := activeConns.Load()
+		if n >= int64(limits.MaxConns) {
+			return false
+		}
+		if activeConns.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+func releaseConn() {
+	activeConns.Add(-1)
+}
+
+// Reports whether the remote host of the connection may start another handshake
+func allowHandshake(conn net.Conn) bool {
+	if handshakeLimiter == nil {
+		return true
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+	return handshakeLimiter.Allow(host)
+}
+
+// Creates the submission rate limiter of a client, nil if unlimited
+func newSubmitLimiter() *ratelimit.Bucket {
+	if limits.Rate <= 0 {
+		return nil
+	}
+	return ratelimit.NewBucket(limits.Rate, limits.Burst)
+}
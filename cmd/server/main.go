@@ -1,166 +1,650 @@
 package main
 
 import (
-	"crypto/rsa"
-	"encoding/binary"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/omersuve/go-parallel-sign/pkg/auth"
-	"github.com/omersuve/go-parallel-sign/pkg/pool"
+	"github.com/omersuve/go-parallel-sign/pkg/logging"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
 )
 
-var clientCounter int32
 var mu        	  sync.Mutex
-var conns         []net.Conn     // Track all connections
-var	connsMu       sync.Mutex     // Protect connenctions slice
-var publicKeys    map[int32]*rsa.PublicKey // Client ID -> public key
+var connections   = newConnRegistry()      // Client ID -> connection, from accept until disconnect
+var rooms         map[string]*room         // Room name -> room, read-only once the server started
+var roomsLeft     int                      // Rooms that still have rounds to play, protected by mu
+var bans          = newBanList()
+var config        serverConfig             // Set once flags are parsed
+var exitOnce      sync.Once
 
 func main() {
 	maxNumbers := flag.Int("max", 800, "maximum number of unique primes to collect") // Default max is 800
+	numRounds := flag.Int("rounds", 1, "number of rounds to play, the pool is reset after each round") // Default is a single round
+	rule := flag.String("rule", "prime", "validation rule for submitted numbers (prime, any, twin, sophie-germain, palindromic, range:LO-HI)")
+	roomsSpec := flag.String("rooms", "", "comma separated rooms as name:max[:rule], defaults to a single room using -max and -rule")
+	metricsAddr := flag.String("metrics", "", "address to serve metrics on, e.g. :9100 (disabled if empty)")
+	adminAddr := flag.String("admin", "", "address to serve the admin API on, localhost only unless a host is given (disabled if empty)")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token for the admin API, generated if empty")
+	logLevel := flag.String("log-level", "info", "log level (debug, info, warn, error)")
+	logFormat := flag.String("log-format", "text", "log format (text, json)")
+	logSample := flag.Int("log-sample", 100, "per second, log the first N occurrences of an event below warn level then every Nth (0 disables sampling)")
+	maxConns := flag.Int("max-conns", 0, "maximum number of concurrent connections (0 for unlimited)")
+	submitRate := flag.Float64("rate", 0, "submissions per second allowed per client, faster clients are asked to slow down (0 for unlimited)")
+	submitBurst := flag.Int("burst", 10, "submission burst size per client")
+	handshakeRate := flag.Float64("handshake-rate", 0, "handshakes per second allowed per remote host (0 for unlimited)")
+	handshakeBurst := flag.Int("handshake-burst", 5, "handshake burst size per remote host")
+	abuseThrottle := flag.Int("abuse-throttle", 0, "invalid signatures after which a client is throttled (0 disables)")
+	abuseThrottleRate := flag.Float64("abuse-throttle-rate", 1, "submissions per second allowed for a throttled client")
+	abuseDisconnect := flag.Int("abuse-disconnect", 0, "invalid signatures after which a client is disconnected (0 disables)")
+	abuseBan := flag.Duration("abuse-ban", 0, "how long the key of a client disconnected for abuse is banned (0 disables)")
+	abusePenalty := flag.Int("abuse-penalty", 0, "points deducted from the score of a client disconnected for abuse")
+	handshakeTimeout := flag.Duration("handshake-timeout", 10*time.Second, "time allowed to complete the handshake (0 disables)")
+	idleTimeout := flag.Duration("idle-timeout", time.Minute, "evict clients that send no frame for this long, pings included (0 disables)")
+	writeTimeout := flag.Duration("write-timeout", 10*time.Second, "time allowed for a single write to a client (0 disables)")
+	leaseTimeout := flag.Duration("lease-timeout", time.Minute, "reassign the work unit of a client that sends no frame for this long (0 only reassigns released units)")
+	resumeWindow := flag.Duration("resume-window", time.Minute, "how long a disconnected client can resume its session with its resume token (0 disables)")
+	verifyWorkers := flag.Int("verify-workers", 0, "goroutines verifying signatures (0 for GOMAXPROCS)")
+	verifyQueue := flag.Int("verify-queue", 1024, "signature verifications waiting for a worker before submissions are shed with a slow down response")
+	rangeSize := flag.Int64("range-size", 1<<16, "numbers per work unit leased to clients")
+	leaderboardInterval := flag.Duration("leaderboard-interval", time.Second, "how often subscribed clients get the room's leaderboard (0 disables)")
+	reportPath := flag.String("report", "", "write the final results to <report>.json, <report>.csv and <report>_primes.csv (disabled if empty)")
     flag.Parse()
 
-	listener, err := net.Listen("tcp", ":3000")
+	// Logs go to stderr, results are printed to stdout
+	logger, err := logging.New(os.Stderr, logging.Options{Level: *logLevel, Format: *logFormat, Sample: *logSample})
 	if err != nil {
-		fmt.Println("Error starting server:", err)
+		fmt.Println("Error configuring logging:", err)
+		return
+	}
+	slog.SetDefault(logger)
+
+	if *rangeSize < 1 {
+		slog.Error("invalid -range-size value, must be at least 1", "range_size", *rangeSize)
+		return
+	}
+	if *verifyQueue < 0 {
+		slog.Error("invalid -verify-queue value, must not be negative", "verify_queue", *verifyQueue)
+		return
+	}
+	if *numRounds < 1 {
+		slog.Error("invalid -rounds value, must be at least 1", "rounds", *numRounds)
 		return
 	}
-	fmt.Println("Server started on :3000")
 
 	// Record start time
 	startTime := time.Now()
+	config = serverConfig{
+		Max:       *maxNumbers,
+		Rounds:    *numRounds,
+		Rule:      *rule,
+		Rooms:     *roomsSpec,
+		Report:    *reportPath,
+		Limits: limitConfig{
+			MaxConns:       *maxConns,
+			Rate:           *submitRate,
+			Burst:          *submitBurst,
+			HandshakeRate:  *handshakeRate,
+			HandshakeBurst: *handshakeBurst,
+		},
+		Abuse: abuseConfig{
+			Throttle:     *abuseThrottle,
+			ThrottleRate: *abuseThrottleRate,
+			Disconnect:   *abuseDisconnect,
+			Ban:          *abuseBan,
+			Penalty:      *abusePenalty,
+		},
+		Timeouts: timeoutConfig{
+			Handshake: *handshakeTimeout,
+			Idle:      *idleTimeout,
+			Write:     *writeTimeout,
+			Resume:    *resumeWindow,
+			Lease:     *leaseTimeout,
+		},
+		Verify: verifyConfig{
+			Workers: *verifyWorkers,
+			Queue:   *verifyQueue,
+		},
+		LeaderboardInterval: *leaderboardInterval,
+		RangeSize:           *rangeSize,
+		StartTime:           startTime,
+	}
+	setupLimits(config.Limits)
+	abuse = config.Abuse
+	timeouts = config.Timeouts
+	verifications = newVerifyPool(config.Verify)
+
+	rooms, err = parseRooms(*roomsSpec, *maxNumbers, *rule, *numRounds, startTime)
+	if err != nil {
+		slog.Error("configuring rooms", "err", err)
+		return
+	}
+	roomsLeft = len(rooms)
 
-	p := pool.NewNumberPool(*maxNumbers)
-	publicKeys = make(map[int32]*rsa.PublicKey)
+	listener, err := net.Listen("tcp", ":3000")
+	if err != nil {
+		slog.Error("starting server", "err", err)
+		return
+	}
+	slog.Info("server started", "addr", ":3000")
+	for _, r := range rooms {
+		slog.Info("room configured", "room", r.name, "max", r.pool.Max(), "rule", r.rule, "rounds", *numRounds)
+		recordPoolFill(r)
+	}
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr)
+	}
+	if *leaderboardInterval > 0 {
+		go streamLeaderboards(*leaderboardInterval)
+	}
+	if *adminAddr != "" {
+		token := *adminToken
+		if token == "" {
+			token, err = generateToken()
+			if err != nil {
+				slog.Error("generating admin token", "err", err)
+				return
+			}
+			slog.Info("admin token generated", "token", token)
+		}
+		go serveAdmin(adminListenAddr(*adminAddr), token)
+	}
+	go shutdownOnSignal()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			fmt.Println("Error accepting connection:", err)
+			slog.Error("accepting connection", "err", err)
 			continue
 		}
-		clientID := registerClient(conn)
-		go handleClient(conn, p, *maxNumbers, clientID, startTime)
+		conn = &timeoutConn{conn}
+		if !acquireConn() {
+			slog.Warn("rejected connection, server at capacity", "remote_addr", conn.RemoteAddr().String(), "max_conns", limits.MaxConns)
+			handshakeFailures.Inc("too_many_connections")
+			go func() {
+				rejectClient(conn, "too many connections")
+				conn.Close()
+			}()
+			continue
+		}
+		go handleClient(connections.Register(conn))
 	}
 }
 
-func handleClient(conn net.Conn, p *pool.NumberPool, maxNumbers int, clientID int32, startTime time.Time) {
-	defer conn.Close()
+func handleClient(c *clientConn) {
+	var sess *session
+	defer releaseConn()
+	defer func() {
+		// The ID must be free again before another connection can resume the session
+		connections.Remove(c)
+		if sess != nil {
+			sessions.Detach(sess)
+		}
+	}()
+	defer c.flush() // The writer closes the connection once the queued frames are out
+	conn, clientID := c.conn, c.ID() // conn is only read from, frames are written through c
+	logger := slog.With("client_id", clientID, "remote_addr", conn.RemoteAddr().String())
+
+	if !allowHandshake(conn) {
+		logger.Warn("rejected handshake, rate limit exceeded")
+		handshakeFailures.Inc("rate_limited")
+		rejectClient(c, "too many handshakes, slow down")
+		return
+	}
 
-	// Read client's public key
-	pubBytes := make([]byte, 4096)
-	n, err := conn.Read(pubBytes)
+	// Read client's hello with the room to join and its public key
+	setReadTimeout(conn, timeouts.Handshake)
+	payload, err := protocol.ReadFrameOf(conn, protocol.FrameHello)
+	if err != nil {
+		logger.Warn("reading hello", "err", err)
+		if isTimeout(err) {
+			handshakeFailures.Inc("timeout")
+			rejectClient(c, "handshake timed out")
+		} else {
+			handshakeFailures.Inc("read_error")
+		}
+		return
+	}
+	var hello protocol.Hello
+	if err := protocol.DecodeJSON(payload, &hello); err != nil {
+		logger.Warn("decoding hello", "err", err)
+		handshakeFailures.Inc("invalid_hello")
+		return
+	}
+	pubKey, err := auth.ParseAnyPublicKey(hello.PublicKey)
 	if err != nil {
-		fmt.Println("Error reading public key:", err)
+		logger.Warn("parsing public key", "err", err)
+		handshakeFailures.Inc("invalid_key")
+		rejectClient(c, "invalid public key")
 		return
 	}
-	pubKey, err := auth.ParsePublicKey(pubBytes[:n])
+	fingerprint, err := auth.Fingerprint(pubKey)
 	if err != nil {
-		fmt.Println("Error parsing public key:", err)
+		logger.Warn("fingerprinting public key", "err", err)
+		handshakeFailures.Inc("invalid_key")
+		rejectClient(c, "invalid public key")
 		return
 	}
-	mu.Lock()
-	publicKeys[clientID] = pubKey
-	mu.Unlock()
-
-	err = binary.Write(conn, binary.LittleEndian, clientID)
+	// Decoded once, submissions are verified with the session's verifier without looking the key up again
+	keyVerifier, err := auth.NewVerifier(pubKey)
+	if err != nil {
+		logger.Warn("decoding public key", "err", err)
+		handshakeFailures.Inc("invalid_key")
+		rejectClient(c, "invalid public key")
+		return
+	}
+	logger = logger.With("key_fingerprint", fingerprint)
+	if bans.IsBanned(fingerprint) {
+		logger.Warn("rejected banned key")
+		handshakeFailures.Inc("banned")
+		rejectClient(c, "key is banned")
+		return
+	}
+	// A client reconnecting with its resume token takes back its client ID and room
+	if hello.ResumeToken != "" {
+		resumed, ok := sessions.Resume(hello.ResumeToken, fingerprint)
+		if ok && connections.Resume(c, resumed.clientID) {
+			sess, clientID = resumed, resumed.clientID
+			if fingerprint != sess.fingerprint {
+				// The client presented the key it rotated away from, the session goes on with the new key
+				pubKey, fingerprint = sess.verifier.PublicKey(), sess.fingerprint
+			}
+			logger = slog.With("client_id", clientID, "remote_addr", conn.RemoteAddr().String(), "key_fingerprint", fingerprint)
+		} else {
+			if ok {
+				sessions.Detach(resumed)
+			}
+			logger.Info("resume token not accepted, joining as a new client")
+		}
+	}
+	resumed := sess != nil
+	r, ok := rooms[hello.Room]
+	if resumed {
+		r, ok = sess.room, true
+	}
+	if !ok {
+		logger.Warn("rejected unknown room", "room", hello.Room)
+		handshakeFailures.Inc("unknown_room")
+		rejectClient(c, fmt.Sprintf("unknown room %q", hello.Room))
+		return
+	}
+	logger = logger.With("room", r.name)
+	if !r.join(c, pubKey, fingerprint) {
+		logger.Info("rejected finished room")
+		handshakeFailures.Inc("room_finished")
+		rejectClient(c, fmt.Sprintf("room %q is finished", hello.Room))
+		return
+	}
+	if !resumed {
+		if sess, err = sessions.Create(clientID, r, fingerprint, keyVerifier); err != nil {
+			logger.Error("creating session", "err", err)
+			handshakeFailures.Inc("internal_error")
+			rejectClient(c, "internal error")
+			return
+		}
+	}
+	c.setSession(sess)
+	// A resumed client gets the unit it already holds
+	var workRange *protocol.Range
+	var unitID int64
+	if hello.WantRange {
+		if lease, ok := leaseUnit(r, sess, logger); ok {
+			workRange, unitID = &lease.Range, lease.UnitID
+		}
+	}
+	err = protocol.WriteJSON(c, protocol.FrameWelcome, protocol.Welcome{
+		ClientID:    clientID,
+		Room:        r.name,
+		Max:         r.pool.Max(),
+		Rule:        r.rule,
+		Rounds:      r.rounds.total,
+		IdleTimeout: timeouts.Idle.Milliseconds(),
+		ResumeToken: sess.token,
+		Resumed:     resumed,
+		Acked:       sess.acked,
+		LastStatus:  sess.lastStatus,
+		Rotations:   sess.rotations,
+		Range:       workRange,
+		UnitID:      unitID,
+	})
 	if err != nil {
-		fmt.Println("Error sending client ID:", err)
+		logger.Warn("sending welcome", "err", err)
+		handshakeFailures.Inc("write_error")
 		return
 	}
+	logger.Info("client joined", "key_algorithm", auth.KeyAlgorithm(pubKey), "resumed", resumed)
+	connectedClients.Inc()
+	defer connectedClients.Dec()
 
-	var num int32
-	signature := make([]byte, 256)
+	round := r.rounds.Current()
+	rotating := resumed // The key replaced by the last rotation can resume the session until the client's next frame
+	limiter := newSubmitLimiter()
+	tracker := &sess.abuse
+	// Responses go through respond so that the session knows what a resuming client already got
+	respond := func(status int32) error {
+		sess.ack(status)
+		return protocol.WriteResponse(c, status)
+	}
+	// Reports whether a submission can be counted now, or the status telling the client why not
+	admit := func() (int32, bool) {
+		if current := r.rounds.Current(); current != round {
+			// A new round started since the last submission, the number is not counted
+			round = current
+			recordSubmission(r, clientID, resultStaleRound)
+			return protocol.StatusNewRound, false
+		}
+		if (limiter != nil && !limiter.Allow()) || !tracker.allow() {
+			// Ask the client to back off, the number is not counted
+			recordSubmission(r, clientID, resultRateLimited)
+			return protocol.StatusSlowDown, false
+		}
+		if r.paused.Load() {
+			recordSubmission(r, clientID, resultPaused)
+			return protocol.StatusPaused, false
+		}
+		return 0, true
+	}
+	// Counts a submission admitted in the given round once its signature is verified. end is set when the connection
+	// must end: with StatusDone when the number completed the room, otherwise the client was disconnected for abuse.
+	judge := func(num int32, cert []byte, verified bool, admittedIn int) (status int32, end bool) {
+		if !verified {
+			logger.Warn("invalid signature", "number", num)
+			recordSubmission(r, clientID, resultInvalidSignature)
+			switch tracker.recordInvalid() {
+			case abuseThrottle:
+				logger.Warn("throttling client for invalid signatures", "invalid", tracker.invalid, "rate", abuse.ThrottleRate)
+				abuseActions.Inc("throttle")
+			case abuseDisconnect:
+				punishClient(r, clientID, fingerprint, c, logger)
+				sessions.Delete(sess)
+				return protocol.StatusInvalidSignature, true
+			}
+			return protocol.StatusInvalidSignature, false
+		}
+		if !r.valid(num, cert) {
+			logger.Info("rejected invalid number", "number", num, "rule", r.rule)
+			recordSubmission(r, clientID, resultInvalidNumber)
+			return protocol.StatusInvalidNumber, false
+		}
+		outcome, res, last := r.rounds.Add(r.pool, num, clientID, admittedIn)
+		switch outcome {
+		case addRoomDone:
+			return protocol.StatusShutdown, false
+		case addStaleRound:
+			// The round finished while the number was verified, or an earlier number of the batch finished it
+			round = r.rounds.Current()
+			recordSubmission(r, clientID, resultStaleRound)
+			return protocol.StatusNewRound, false
+		case addDuplicate:
+			recordSubmission(r, clientID, resultDuplicate)
+			logger.Debug("rejected duplicate", "number", num)
+			return protocol.StatusDuplicate, false
+		}
+		length := r.pool.Len()
+		if outcome == addRoundFinished {
+			length = len(res.Numbers) // The pool was reset for the next round
+		}
+		logger.Info("number accepted", "number", num, "pool_length", length)
+		recordSubmission(r, clientID, resultAccepted)
+		recordPoolFill(r)
+		if outcome == addAccepted {
+			return protocol.StatusAdded, false
+		}
+		if r.rounds.total > 1 {
+			printRoundResult(r.name, res, r.rounds.total)
+		}
+		if last {
+			// Room is done, the caller notifies its clients and shuts down once every room is done
+			announceRoundResult(r, res)
+			return protocol.StatusDone, true
+		}
+		announceRoundResult(r, res)
+		recordPoolFill(r)
+		round = r.rounds.Current()
+		return protocol.StatusRoundComplete, false
+	}
 
 	for {
-		err := binary.Read(conn, binary.LittleEndian, &num)
+		// Every frame, pings included, must arrive within the idle timeout
+		setReadTimeout(conn, timeouts.Idle)
+		frameType, payload, err := protocol.ReadFrame(conn)
+		if isTimeout(err) {
+			logger.Info("evicting idle client", "idle_timeout", timeouts.Idle)
+			idleEvictions.Inc()
+			rejectClient(c, "idle timeout")
+			return
+		}
 		if err != nil {
-			fmt.Println("Client disconnected or error:", err)
+			logger.Info("client disconnected", "err", err)
+			return
+		}
+		sess.touch()
+		if rotating {
+			sessions.ConfirmRotation(sess)
+			rotating = false
+		}
+		if frameType == protocol.FramePing {
+			if err := protocol.WriteFrame(c, protocol.FramePong, nil); err != nil {
+				logger.Warn("sending pong", "err", err)
+				return
+			}
+			continue
+		}
+		if frameType == protocol.FrameSubscribe {
+			var sub protocol.Subscribe
+			if err := protocol.DecodeJSON(payload, &sub); err != nil {
+				logger.Warn("decoding subscription", "err", err)
+				return
+			}
+			c.subscribed.Store(sub.Leaderboard)
+			logger.Debug("subscription changed", "leaderboard", sub.Leaderboard)
+			continue
+		}
+		if frameType == protocol.FrameRotateKey {
+			previous := fingerprint
+			if fingerprint, err = handleRotateKey(c, sess, payload, logger); err != nil {
+				logger.Warn("handling key rotation", "err", err)
+				return
+			}
+			rotating = fingerprint != previous
+			logger = slog.With("client_id", clientID, "remote_addr", conn.RemoteAddr().String(), "key_fingerprint", fingerprint, "room", r.name)
+			continue
+		}
+		if frameType == protocol.FrameLeaseRequest || frameType == protocol.FrameComplete {
+			if err := handleWork(c, r, sess, frameType, payload, logger); err != nil {
+				logger.Warn("handling work unit", "err", err)
+				return
+			}
+			continue
+		}
+		var batch []protocol.Submission
+		var cert []byte
+		switch frameType {
+		case protocol.FrameSubmit:
+			var sub protocol.Submission
+			sub.Num, sub.Signature, err = protocol.DecodeSubmit(payload)
+			batch = []protocol.Submission{sub}
+		case protocol.FrameSubmitCertified:
+			var sub protocol.Submission
+			sub.Num, sub.Signature, cert, err = protocol.DecodeSubmitCertified(payload)
+			batch = []protocol.Submission{sub}
+		case protocol.FrameSubmitBatch:
+			batch, err = protocol.DecodeSubmitBatch(payload)
+		default:
+			logger.Warn("unexpected frame", "type", frameType)
 			return
 		}
-		n, err := conn.Read(signature)
 		if err != nil {
-			fmt.Println("Error reading signature:", err)
+			logger.Warn("decoding submission", "err", err)
 			return
 		}
-		sig := signature[:n]
-
-		var response int32
-		mu.Lock()
-		pubKey = publicKeys[clientID]
-		mu.Unlock()
-		if !auth.Verify(num, sig, pubKey) {
-			fmt.Printf("Invalid signature for %d from client %d\n", num, clientID)
-			response = -3 // Invalid signature response code: -3
-		} else if p.Add(num, clientID) {
-			fmt.Printf("Received %d from client %d, Pool length: %d\n", num, clientID, p.Len())
-			if p.Len() < maxNumbers {
-				response = 1 // Added successfully response code: 1
-			} else if p.Len() == maxNumbers {
-				notifyClientsAndshutdownServer(p, maxNumbers, startTime, conn)
-				// Server is shutting down, notify clients and exit
+
+		// A batch gets a single response with the status of each number
+		reply := func(statuses []int32) error {
+			if frameType != protocol.FrameSubmitBatch {
+				return respond(statuses[0])
+			}
+			for _, status := range statuses {
+				sess.ack(status)
+			}
+			return protocol.WriteBatchResponse(c, statuses)
+		}
+		statuses := make([]int32, len(batch))
+		if r.isDone() {
+			// Room finished while the submission was in flight
+			for i := range statuses {
+				statuses[i] = protocol.StatusShutdown
+			}
+			reply(statuses)
+			return
+		}
+
+		// The numbers that can be counted now have their signatures verified together
+		var admitted []int   // Indexes in batch of the numbers to verify
+		var admittedIn []int // Round each of them was admitted in
+		var items []auth.BatchItem
+		for i, sub := range batch {
+			status, ok := admit()
+			if !ok {
+				statuses[i] = status
+				continue
+			}
+			admitted = append(admitted, i)
+			admittedIn = append(admittedIn, round)
+			items = append(items, auth.BatchItem{Num: sub.Num, Signature: sub.Signature, Verifier: sess.verifier})
+		}
+		verified, ok := []bool(nil), true
+		if len(items) > 0 {
+			verified, ok = verifications.VerifyBatch(items)
+		}
+		if !ok {
+			// Every verification worker is busy and the queue is full, the numbers are not counted
+			logger.Debug("shedding submissions, verification queue full", "count", len(admitted))
+			for _, i := range admitted {
+				recordSubmission(r, clientID, resultShed)
+				statuses[i] = protocol.StatusSlowDown
+			}
+			admitted = nil
+		}
+		for j, i := range admitted {
+			status, end := judge(batch[i].Num, cert, verified[j], admittedIn[j])
+			statuses[i] = status
+			if end && status != protocol.StatusDone {
+				return // Disconnected for abuse
+			}
+			if end {
+				// Room is done, numbers after the last one are not counted
+				for _, k := range admitted[j+1:] {
+					statuses[k] = protocol.StatusShutdown
+				}
+				if err := reply(statuses); err != nil {
+					logger.Warn("sending feedback", "err", err)
+				}
+				notifyClientsAndFinishRoom(r, c)
+				return
 			}
-		} else {
-			response = 0 // Duplicate number response code: 0
-			fmt.Printf("Rejected %d (duplicate)\n", num)
 		}
 
-		// Send feedback to the client unless server is not shutting down due to having all primes collected
-		err = binary.Write(conn, binary.LittleEndian, response)
+		// Send feedback to the client
+		err = reply(statuses)
 		if err != nil {
-			fmt.Println("Error sending feedback:", err)
+			logger.Warn("sending feedback", "err", err)
 			return
 		}
 	}
 }
 
-// registerClient assigns a client ID and tracks the connection
-func registerClient(conn net.Conn) int32 {
-	mu.Lock()
-	clientCounter++
-	clientID := clientCounter
-	mu.Unlock()
-	connsMu.Lock()
-	conns = append(conns, conn)
-	connsMu.Unlock()
-	return clientID
+// Tells the client why its handshake was rejected
+func rejectClient(w io.Writer, message string) {
+	err := protocol.WriteJSON(w, protocol.FrameError, protocol.Error{Message: message})
+	if err != nil {
+		slog.Warn("sending rejection", "message", message, "err", err)
+	}
 }
 
-// shutdownServer prints results and terminates the server
-func notifyClientsAndshutdownServer(p *pool.NumberPool, maxNumbers int, startTime time.Time, triggeringConn net.Conn) {
+// Prints the room's results, notifies its clients and terminates the server once every room is done.
+// trigger completed the room and already got its response, it is nil when the room was ended from the admin API.
+func notifyClientsAndFinishRoom(r *room, trigger *clientConn) {
 	endTime := time.Now()
-	duration := endTime.Sub(startTime)
+	duration := endTime.Sub(r.startTime)
 
-	fmt.Printf("Collected %d numbers, final pool length: %v\n", maxNumbers, p.Len())
-	scoreboard := p.GetScoreboard()
-	fmt.Println("---SCORES---")
-	for id, count := range scoreboard {
-		fmt.Printf("Client %d: %d numbers\n", id, count)
+	fmt.Printf("Room %s collected %d numbers, final pool length: %v\n", r.name, r.pool.Max(), r.pool.Len())
+	if r.rounds.total > 1 {
+		// Each round was printed when it finished
+		standings := r.rounds.Standings()
+		fmt.Println("---STANDINGS---")
+		for _, id := range rankScores(standings) {
+			fmt.Printf("Client %d: %d numbers\n", id, standings[id])
+		}
+		fmt.Printf("Time taken to play %d rounds of %d primes: %v\n", r.rounds.total, r.pool.Max(), duration)
+	} else {
+		scoreboard := r.pool.GetScoreboard()
+		fmt.Println("---SCORES---")
+		for _, id := range rankScores(scoreboard) {
+			fmt.Printf("Client %d: %d numbers\n", id, scoreboard[id])
+		}
+		fmt.Printf("Time taken to collect %d primes: %v\n", r.pool.Max(), duration)
 	}
-	fmt.Printf("Time taken to collect %d primes: %v\n", maxNumbers, duration)
 
-	// Send shutdown signal to the client
-	err := binary.Write(triggeringConn, binary.LittleEndian, int32(-1))
-	if err != nil {
-		fmt.Println("Error sending shutdown response:", err)
+	// Notify all other clients of the room
+	r.doneMu.Lock()
+	r.done = true
+	r.endTime = endTime
+	broadcastShutdown(r, trigger)
+	r.doneMu.Unlock()
+
+	mu.Lock()
+	roomsLeft--
+	left := roomsLeft
+	mu.Unlock()
+	if left > 0 {
+		slog.Info("room finished", "room", r.name, "rooms_left", left)
+		return
 	}
 
-	// Notify all other clients
-	connsMu.Lock()
-	for i, c := range conns {
-		if c != triggeringConn { // Skip the client that triggered shutdown
-			err := binary.Write(c, binary.LittleEndian, int32(-2))
-			if err != nil {
-				fmt.Printf("Failed to send -2 to conn %d: %v\n", i, err)
-			}
+	exitServer()
+}
+
+// Ends the rooms still playing when the server is interrupted, so that their clients are told and the report is written
+func shutdownOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	slog.Info("received signal, shutting down", "signal", sig.String())
+	endTime := time.Now()
+	for _, r := range rooms {
+		r.doneMu.Lock()
+		if !r.done {
+			r.done = true
+			r.endTime = endTime
+			broadcastShutdown(r, nil)
 		}
+		r.doneMu.Unlock()
 	}
-	connsMu.Unlock()
+	exitServer()
+}
 
-	fmt.Println("Server shutting down")
-	os.Exit(0)
-}
\ No newline at end of file
+// Writes the report, lets the queued frames reach the clients and exits. Only the first caller proceeds,
+// the others wait for the process to exit.
+func exitServer() {
+	exitOnce.Do(func() {
+		if config.Report != "" {
+			if err := writeReport(config.Report, time.Now()); err != nil {
+				slog.Error("writing report", "err", err)
+			} else {
+				slog.Info("report written", "path", config.Report)
+			}
+		}
+
+		slog.Info("server shutting down")
+		connections.FlushAll() // Let the shutdown notices reach the clients
+		os.Exit(0)
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/metrics"
+)
+
+// Submission results used as the result label
+const (
+	resultAccepted         = "accepted"
+	resultDuplicate        = "duplicate"
+	resultInvalidSignature = "invalid_signature"
+	resultInvalidNumber    = "invalid_number"
+	resultStaleRound       = "stale_round"
+	resultPaused           = "paused"
+	resultRateLimited      = "rate_limited"
+	resultShed             = "shed" // Verification queue was full
+)
+
+var (
+	registry = metrics.NewRegistry()
+
+	connectedClients = registry.NewGauge("parallel_sign_connected_clients",
+		"Clients that completed the handshake and are still connected")
+	submissionsTotal = registry.NewCounter("parallel_sign_submissions_total",
+		"Submissions received per client and result", "room", "client", "result")
+	submissionRate = registry.NewGauge("parallel_sign_submissions_per_second",
+		"Submissions received during the last second")
+	poolFill = registry.NewGauge("parallel_sign_pool_fill_ratio",
+		"Fraction of the current round's pool that is filled", "room")
+	verifyLatency = registry.NewHistogram("parallel_sign_signature_verification_seconds",
+		"Time spent verifying the signatures of a submission or batch", metrics.ExponentialBuckets(0.00001, 2, 12))
+	verifyWorkers = registry.NewGauge("parallel_sign_verify_workers",
+		"Goroutines of the signature verification pool")
+	verifyQueueDepth = registry.NewGauge("parallel_sign_verify_queue_depth",
+		"Signature verifications waiting for a worker")
+	verifyShed = registry.NewCounter("parallel_sign_verify_shed_total",
+		"Submissions shed because the signature verification queue was full")
+	abuseActions = registry.NewCounter("parallel_sign_abuse_actions_total",
+		"Throttles, disconnects, bans and penalties applied to clients sending invalid signatures", "action")
+	handshakeFailures = registry.NewCounter("parallel_sign_handshake_failures_total",
+		"Handshakes rejected or aborted per reason", "reason")
+	idleEvictions = registry.NewCounter("parallel_sign_idle_evictions_total",
+		"Clients disconnected after sending no frame within the idle timeout")
+	workUnits = registry.NewCounter("parallel_sign_work_units_total",
+		"Work units leased, reassigned from clients that went silent and completed", "room", "event")
+	certificates = registry.NewCounter("parallel_sign_certificates_total",
+		"Primality certificates attached to submissions per result, valid or invalid", "result")
+	keyRotations = registry.NewCounter("parallel_sign_key_rotations_total",
+		"Key rotations requested by clients per result, rotated or rejected", "result")
+)
+
+var submissionCount atomic.Int64 // All submissions, used to compute submissionRate
+
+// Counts a submission and its result, both in the metrics and in the room's statistics
+func recordSubmission(r *room, clientID int32, result string) {
+	r.record(clientID, result)
+	submissionCount.Add(1)
+	submissionsTotal.Inc(r.name, strconv.Itoa(int(clientID)), result)
+}
+
+// Updates the fill ratio gauge of the room
+func recordPoolFill(r *room) {
+	poolFill.Set(float64(r.pool.Len())/float64(r.pool.Max()), r.name)
+}
+
+// Serves the metrics on addr and keeps the submission rate up to date
+func serveMetrics(addr string) {
+	go func() {
+		var last int64
+		for range time.Tick(time.Second) {
+			current := submissionCount.Load()
+			submissionRate.Set(float64(current - last))
+			last = current
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry.Handler())
+	slog.Info("serving metrics", "url", "http://"+addr+"/metrics")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		slog.Error("serving metrics", "err", err)
+	}
+}
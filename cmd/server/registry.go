@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Lifecycle state of a client connection
+type connState int32
+
+const (
+	stateHandshaking connState = iota // Accepted, the client has not joined a room yet
+	stateActive                       // Joined a room and submitting
+	stateClosed                       // Disconnected, removed from the registry
+)
+
+var stateNames = [...]string{"handshaking", "active", "closed"}
+
+func (s connState) String() string {
+	return stateNames[s]
+}
+
+func (s connState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Frames that can wait for the writer of a connection, a client that falls this far behind is disconnected
+const outboundQueueSize = 64
+
+var errQueueFull = errors.New("outbound queue full")
+
+// A client connection tracked from accept to disconnect.
+// Only its writer goroutine writes to conn, everyone else queues frames with Write.
+type clientConn struct {
+	id          atomic.Int32 // Assigned on accept, replaced with the session's on resume
+	conn        net.Conn
+	remoteAddr  string
+	connectedAt time.Time
+
+	outMu      sync.Mutex // Protects out against sends after closeOutbound
+	out        chan []byte
+	outClosed  bool
+	writerDone chan struct{} // Closed once the writer wrote the queued frames and closed conn
+	subscribed atomic.Bool   // Receives the room's leaderboard
+
+	mu          sync.Mutex // Protects the fields below
+	state       connState
+	room        *room
+	publicKey   crypto.PublicKey
+	fingerprint string
+	session     *session // Nil until the client joined a room
+}
+
+// Queues a frame for the writer goroutine without blocking.
+// It implements io.Writer so that the protocol.Write functions can target the queue, one call per frame.
+func (c *clientConn) Write(frame []byte) (int, error) {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	if c.outClosed {
+		return 0, net.ErrClosed
+	}
+	select {
+	case c.out <- bytes.Clone(frame):
+		return len(frame), nil
+	default:
+		return 0, errQueueFull
+	}
+}
+
+// Frames waiting for the writer
+func (c *clientConn) backlog() int {
+	return len(c.out)
+}
+
+// Writes the queued frames in order until the queue is closed, then closes the connection
+func (c *clientConn) writeLoop() {
+	defer close(c.writerDone)
+	defer c.conn.Close()
+	for frame := range c.out {
+		if _, err := c.conn.Write(frame); err != nil {
+			// Closing unblocks the reader, the remaining frames fail fast
+			slog.Debug("writing to client", "client_id", c.ID(), "err", err)
+			c.conn.Close()
+		}
+	}
+}
+
+// Stops accepting frames, the connection is closed once the queued ones are written
+func (c *clientConn) closeOutbound() {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	if !c.outClosed {
+		c.outClosed = true
+		close(c.out)
+	}
+}
+
+// Closes the outbound queue and waits for the writer to flush it
+func (c *clientConn) flush() {
+	c.closeOutbound()
+	<-c.writerDone
+}
+
+// A client connection as shown in the admin view
+type clientInfo struct {
+	ID          int32     `json:"id"`
+	State       connState `json:"state"`
+	Room        string    `json:"room,omitempty"`
+	RemoteAddr  string    `json:"remote_addr"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+func (c *clientConn) info() clientInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := clientInfo{
+		ID:          c.ID(),
+		State:       c.state,
+		RemoteAddr:  c.remoteAddr,
+		Fingerprint: c.fingerprint,
+		ConnectedAt: c.connectedAt,
+	}
+	if c.room != nil {
+		info.Room = c.room.name
+	}
+	return info
+}
+
+// Marks the client as active in the room with the key it authenticated with
+func (c *clientConn) activate(r *room, publicKey crypto.PublicKey, fingerprint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = stateActive
+	c.room = r
+	c.publicKey = publicKey
+	c.fingerprint = fingerprint
+}
+
+// Replaces the key of an active client after a key rotation
+func (c *clientConn) setKey(publicKey crypto.PublicKey, fingerprint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.publicKey = publicKey
+	c.fingerprint = fingerprint
+}
+
+// Records the session the connection is attached to, once created or resumed
+func (c *clientConn) setSession(sess *session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = sess
+}
+
+// Session the connection is attached to, nil while handshaking
+func (c *clientConn) Session() *session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// Client ID, use it rather than a copy as a resumed client takes over its previous ID
+func (c *clientConn) ID() int32 {
+	return c.id.Load()
+}
+
+func (c *clientConn) State() connState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Key the client authenticated with, nil while handshaking
+func (c *clientConn) PublicKey() crypto.PublicKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.publicKey
+}
+
+func (c *clientConn) Fingerprint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fingerprint
+}
+
+// Room the client joined, nil while handshaking
+func (c *clientConn) Room() *room {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.room
+}
+
+// Client connections keyed by client ID, from accept until disconnect
+type connRegistry struct {
+	mu     sync.RWMutex
+	lastID int32
+	conns  map[int32]*clientConn
+}
+
+func newConnRegistry() *connRegistry {
+	return &connRegistry{conns: make(map[int32]*clientConn)}
+}
+
+// Assigns a client ID to an accepted connection, tracks it as handshaking and starts its writer
+func (g *connRegistry) Register(conn net.Conn) *clientConn {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lastID++
+	c := &clientConn{
+		conn:        conn,
+		remoteAddr:  conn.RemoteAddr().String(),
+		connectedAt: time.Now(),
+		out:         make(chan []byte, outboundQueueSize),
+		writerDone:  make(chan struct{}),
+	}
+	c.id.Store(g.lastID)
+	g.conns[c.ID()] = c
+	go c.writeLoop()
+	return c
+}
+
+// Marks the connection as closed and stops tracking it
+func (g *connRegistry) Remove(c *clientConn) {
+	c.mu.Lock()
+	c.state = stateClosed
+	c.mu.Unlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.conns, c.ID())
+}
+
+// Moves the handshaking connection to the ID of the session it resumes, fails if that ID is still in use
+func (g *connRegistry) Resume(c *clientConn, id int32) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.conns[id]; ok {
+		return false
+	}
+	delete(g.conns, c.ID())
+	c.id.Store(id)
+	g.conns[id] = c
+	return true
+}
+
+func (g *connRegistry) Get(id int32) (*clientConn, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	c, ok := g.conns[id]
+	return c, ok
+}
+
+// Tracked connections in any state, sorted by client ID
+func (g *connRegistry) List() []*clientConn {
+	g.mu.RLock()
+	list := make([]*clientConn, 0, len(g.conns))
+	for _, c := range g.conns {
+		list = append(list, c)
+	}
+	g.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID() < list[j].ID() })
+	return list
+}
+
+// Active connections of the room, or of every room if r is nil, sorted by client ID
+func (g *connRegistry) Active(r *room) []*clientConn {
+	var active []*clientConn
+	for _, c := range g.List() {
+		c.mu.Lock()
+		if c.state == stateActive && (r == nil || c.room == r) {
+			active = append(active, c)
+		}
+		c.mu.Unlock()
+	}
+	return active
+}
+
+// Flushes the queued frames of every connection and closes them, used before the server exits
+func (g *connRegistry) FlushAll() {
+	list := g.List()
+	for _, c := range list {
+		c.closeOutbound()
+	}
+	for _, c := range list {
+		<-c.writerDone
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Configuration the server was started with, recorded in the report
+type serverConfig struct {
+	Max                 int           `json:"max"`
+	Rounds              int           `json:"rounds"`
+	Rule                string        `json:"rule"`
+	Rooms               string        `json:"rooms"`
+	Report              string        `json:"report"`
+	Limits              limitConfig   `json:"limits"`
+	Abuse               abuseConfig   `json:"abuse"`
+	Timeouts            timeoutConfig `json:"timeouts"`
+	Verify              verifyConfig  `json:"verify"`
+	LeaderboardInterval time.Duration `json:"leaderboard_interval"`
+	RangeSize           int64         `json:"range_size"`
+	StartTime           time.Time     `json:"-"`
+}
+
+// Encodes the durations as strings such as "1m0s" rather than nanoseconds
+func (c serverConfig) MarshalJSON() ([]byte, error) {
+	type plain serverConfig
+	return json.Marshal(struct {
+		plain
+		LeaderboardInterval string `json:"leaderboard_interval"`
+	}{plain(c), c.LeaderboardInterval.String()})
+}
+
+// Final results of the server
+type report struct {
+	Config          serverConfig `json:"config"`
+	StartTime       time.Time    `json:"start_time"`
+	EndTime         time.Time    `json:"end_time"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	Rooms           []roomReport `json:"rooms"`
+}
+
+type roomReport struct {
+	Name            string        `json:"name"`
+	Max             int           `json:"max"`
+	Rule            string        `json:"rule"`
+	StartTime       time.Time     `json:"start_time"`
+	EndTime         time.Time     `json:"end_time"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Submissions     int           `json:"submissions"`
+	SubmissionsPerS float64       `json:"submissions_per_second"`
+	AcceptedPerS    float64       `json:"accepted_per_second"`
+	Ranking         []rankEntry   `json:"ranking"`
+	Rounds          []roundReport `json:"rounds"`
+}
+
+// A client's place in a room, ranked by accepted numbers minus penalties over all rounds
+type rankEntry struct {
+	Rank     int   `json:"rank"`
+	ClientID int32 `json:"client_id"`
+	clientStats
+}
+
+// Ranks the clients of a room by score
+func rankStats(stats map[int32]clientStats) []rankEntry {
+	scores := make(map[int32]int, len(stats))
+	for id, s := range stats {
+		scores[id] = s.score()
+	}
+	ranking := make([]rankEntry, 0, len(stats))
+	for i, id := range rankScores(scores) {
+		ranking = append(ranking, rankEntry{Rank: i + 1, ClientID: id, clientStats: stats[id]})
+	}
+	return ranking
+}
+
+type roundReport struct {
+	Round           int           `json:"round"`
+	StartTime       time.Time     `json:"start_time"`
+	EndTime         time.Time     `json:"end_time"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Scoreboard      map[int32]int `json:"scoreboard"`
+	Primes          []int32       `json:"primes"`
+}
+
+// Collects the results of every room
+func buildReport(endTime time.Time) report {
+	rep := report{
+		Config:          config,
+		StartTime:       config.StartTime,
+		EndTime:         endTime,
+		DurationSeconds: endTime.Sub(config.StartTime).Seconds(),
+	}
+	for _, r := range rooms {
+		rep.Rooms = append(rep.Rooms, buildRoomReport(r, endTime))
+	}
+	sort.Slice(rep.Rooms, func(i, j int) bool { return rep.Rooms[i].Name < rep.Rooms[j].Name })
+	return rep
+}
+
+func buildRoomReport(r *room, endTime time.Time) roomReport {
+	r.doneMu.Lock()
+	if r.done {
+		endTime = r.endTime
+	}
+	r.doneMu.Unlock()
+	duration := endTime.Sub(r.startTime).Seconds()
+
+	rr := roomReport{
+		Name:            r.name,
+		Max:             r.pool.Max(),
+		Rule:            r.rule,
+		StartTime:       r.startTime,
+		EndTime:         endTime,
+		DurationSeconds: duration,
+	}
+
+	stats := r.Stats()
+	totalAccepted := 0
+	for _, s := range stats {
+		totalAccepted += s.Accepted
+		rr.Submissions += s.total()
+	}
+	rr.Ranking = rankStats(stats)
+	if duration > 0 {
+		rr.SubmissionsPerS = float64(rr.Submissions) / duration
+		rr.AcceptedPerS = float64(totalAccepted) / duration
+	}
+
+	history := r.rounds.History()
+	if res, ok := r.rounds.Unfinished(r.pool, endTime); ok {
+		// The server was stopped during the round
+		history = append(history, res)
+	}
+	for _, res := range history {
+		rr.Rounds = append(rr.Rounds, roundReport{
+			Round:           res.Round,
+			StartTime:       res.Start,
+			EndTime:         res.End,
+			DurationSeconds: res.Duration.Seconds(),
+			Scoreboard:      res.Scoreboard,
+			Primes:          res.Numbers,
+		})
+	}
+	return rr
+}
+
+// Writes the report as <path>.json, the ranking as <path>.csv and the primes as <path>_primes.csv
+func writeReport(path string, endTime time.Time) error {
+	rep := buildReport(endTime)
+
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".json", data, 0o644); err != nil {
+		return err
+	}
+
+	ranking := [][]string{{"room", "rank", "client_id", "accepted", "duplicate", "invalid_signature", "invalid_number", "not_counted", "penalty"}}
+	primes := [][]string{{"room", "round", "prime"}}
+	for _, rr := range rep.Rooms {
+		for _, e := range rr.Ranking {
+			ranking = append(ranking, []string{
+				rr.Name,
+				strconv.Itoa(e.Rank),
+				strconv.Itoa(int(e.ClientID)),
+				strconv.Itoa(e.Accepted),
+				strconv.Itoa(e.Duplicate),
+				strconv.Itoa(e.InvalidSignature),
+				strconv.Itoa(e.InvalidNumber),
+				strconv.Itoa(e.NotCounted),
+				strconv.Itoa(e.Penalty),
+			})
+		}
+		for _, round := range rr.Rounds {
+			for _, p := range round.Primes {
+				primes = append(primes, []string{rr.Name, strconv.Itoa(round.Round), strconv.Itoa(int(p))})
+			}
+		}
+	}
+	if err := writeCSV(path+".csv", ranking); err != nil {
+		return err
+	}
+	return writeCSV(path+"_primes.csv", primes)
+}
+
+func writeCSV(path string, records [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.WriteAll(records)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
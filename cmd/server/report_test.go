@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerConfigDurationsAsStrings(t *testing.T) {
+	cfg := serverConfig{
+		Max:                 10,
+		Abuse:               abuseConfig{Disconnect: 3, Ban: time.Hour},
+		Timeouts:            timeoutConfig{Idle: time.Minute, Lease: 90 * time.Second},
+		LeaderboardInterval: 2 * time.Second,
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	got := string(data)
+	for _, want := range []string{`"max":10`, `"disconnect":3`, `"ban":"1h0m0s"`, `"idle":"1m0s"`, `"lease":"1m30s"`, `"handshake":"0s"`, `"leaderboard_interval":"2s"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Marshal() = %s, want it to contain %s", got, want)
+		}
+	}
+	if strings.Count(got, `"ban"`) != 1 || strings.Count(got, `"leaderboard_interval"`) != 1 {
+		t.Errorf("Marshal() = %s, want each duration encoded once", got)
+	}
+}
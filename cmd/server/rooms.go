@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/pool"
+	"github.com/omersuve/go-parallel-sign/pkg/primes"
+)
+
+// Name of the room used when no rooms are configured
+const defaultRoom = "default"
+
+// A named competition with its own pool, validation rule and scoreboard
+type room struct {
+	name      string
+	rule      string // Normalized rule of the validator, announced to clients
+	validator primes.Validator
+	pool      *pool.NumberPool
+	rounds    *roundTracker
+	startTime time.Time
+	paused    atomic.Bool // Submissions are not accepted while paused
+	work      *workQueue  // Ranges leased to the clients that ask for work
+
+	doneMu  sync.Mutex // Protects done and endTime, held while clients join or get notified of the end
+	done    bool       // All rounds of the room have been played
+	endTime time.Time  // When the room was done
+
+	statsMu sync.Mutex
+	stats   map[int32]*clientStats // Client ID -> submission counts over all rounds
+}
+
+// Submission counts of a client in a room
+type clientStats struct {
+	Accepted         int `json:"accepted"`
+	Duplicate        int `json:"duplicate"`
+	InvalidSignature int `json:"invalid_signature"`
+	InvalidNumber    int `json:"invalid_number"`
+	NotCounted       int `json:"not_counted"` // Sent while paused, rate limited or during a round change
+	Penalty          int `json:"penalty"`     // Points deducted for abuse
+}
+
+// Accepted numbers minus penalties
+func (s clientStats) score() int {
+	return s.Accepted - s.Penalty
+}
+
+// Submissions of every kind
+func (s clientStats) total() int {
+	return s.Accepted + s.Duplicate + s.InvalidSignature + s.InvalidNumber + s.NotCounted
+}
+
+func newRoom(name string, max int, rule string, numRounds int, startTime time.Time) (*room, error) {
+	if name == "" {
+		return nil, fmt.Errorf("room name must not be empty")
+	}
+	if max < 1 {
+		return nil, fmt.Errorf("room %q: max must be at least 1", name)
+	}
+	validator, err := primes.ParseValidator(rule)
+	if err != nil {
+		return nil, fmt.Errorf("room %q: %v", name, err)
+	}
+	return &room{
+		name:      name,
+		rule:      validator.String(),
+		validator: validator,
+		pool:      pool.NewNumberPool(max),
+		rounds:    newRoundTracker(numRounds, startTime),
+		startTime: startTime,
+		work:      newWorkQueue(),
+		stats:     make(map[int32]*clientStats),
+	}, nil
+}
+
+// Parses comma separated room definitions of the form name:max[:rule], the rule may contain colons.
+// An empty spec yields a single default room using defaultMax and defaultRule.
+func parseRooms(spec string, defaultMax int, defaultRule string, numRounds int, startTime time.Time) (map[string]*room, error) {
+	rooms := make(map[string]*room)
+	if spec == "" {
+		r, err := newRoom(defaultRoom, defaultMax, defaultRule, numRounds, startTime)
+		if err != nil {
+			return nil, err
+		}
+		rooms[r.name] = r
+		return rooms, nil
+	}
+
+	for _, def := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(def), ":", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid room definition %q, want name:max[:rule]", def)
+		}
+		max, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid max in room definition %q: %v", def, err)
+		}
+		rule := defaultRule
+		if len(parts) == 3 {
+			rule = parts[2]
+		}
+		if _, ok := rooms[parts[0]]; ok {
+			return nil, fmt.Errorf("duplicate room %q", parts[0])
+		}
+		r, err := newRoom(parts[0], max, rule, numRounds, startTime)
+		if err != nil {
+			return nil, err
+		}
+		rooms[r.name] = r
+	}
+	return rooms, nil
+}
+
+// Activates the client in the room, fails if the room is already finished
+func (r *room) join(c *clientConn, publicKey crypto.PublicKey, fingerprint string) bool {
+	r.doneMu.Lock()
+	defer r.doneMu.Unlock()
+	if r.done {
+		return false
+	}
+	c.activate(r, publicKey, fingerprint)
+	return true
+}
+
+// Reports whether all rounds of the room have been played
+func (r *room) isDone() bool {
+	r.doneMu.Lock()
+	defer r.doneMu.Unlock()
+	return r.done
+}
+
+// Checks the number against the room's rule. An encoded primality certificate, when attached, is verified
+// instead of testing the number, a certificate that does not prove it prime makes the number invalid.
+func (r *room) valid(num int32, certificate []byte) bool {
+	if certificate == nil {
+		return r.validator.Valid(num)
+	}
+	var cert primes.Certificate
+	valid := cert.UnmarshalBinary(certificate) == nil && primes.ValidCertified(r.validator, num, &cert)
+	if valid {
+		certificates.Inc("valid")
+	} else {
+		certificates.Inc("invalid")
+	}
+	return valid
+}
+
+// Counts a submission of the client by result
+func (r *room) record(clientID int32, result string) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	s, ok := r.stats[clientID]
+	if !ok {
+		s = &clientStats{}
+		r.stats[clientID] = s
+	}
+	switch result {
+	case resultAccepted:
+		s.Accepted++
+	case resultDuplicate:
+		s.Duplicate++
+	case resultInvalidSignature:
+		s.InvalidSignature++
+	case resultInvalidNumber:
+		s.InvalidNumber++
+	default:
+		s.NotCounted++
+	}
+}
+
+// Records penalty points deducted from the client's score
+func (r *room) penalize(clientID int32, points int) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	s, ok := r.stats[clientID]
+	if !ok {
+		s = &clientStats{}
+		r.stats[clientID] = s
+	}
+	s.Penalty += points
+}
+
+// Returns a copy of the submission counts per client
+func (r *room) Stats() map[int32]clientStats {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	stats := make(map[int32]clientStats, len(r.stats))
+	for id, s := range r.stats {
+		stats[id] = *s
+	}
+	return stats
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Answers a key rotation and returns the fingerprint of the session's key, the new one if it was rotated.
+// The request must be signed by the current key and by the new one, so that neither a third party nor
+// the holder of another key can move the client ID and its scores.
+func handleRotateKey(c *clientConn, sess *session, payload []byte, logger *slog.Logger) (string, error) {
+	var rotate protocol.RotateKey
+	if err := protocol.DecodeJSON(payload, &rotate); err != nil {
+		return "", fmt.Errorf("decoding key rotation: %w", err)
+	}
+	fingerprint, verifier, reason := checkRotation(sess, rotate)
+	if reason != "" {
+		logger.Warn("rejected key rotation", "reason", reason)
+		keyRotations.Inc("rejected")
+		return sess.fingerprint, protocol.WriteJSON(c, protocol.FrameRotateKeyAck, protocol.RotateKeyAck{Message: reason})
+	}
+	sessions.RotateKey(sess, c, verifier, fingerprint)
+	logger.Info("key rotated", "new_key_fingerprint", fingerprint, "key_algorithm", auth.KeyAlgorithm(verifier.PublicKey()))
+	keyRotations.Inc("rotated")
+	return fingerprint, protocol.WriteJSON(c, protocol.FrameRotateKeyAck, protocol.RotateKeyAck{OK: true})
+}
+
+// Validates the new key and both signatures, reason tells the client why the rotation is refused
+func checkRotation(sess *session, rotate protocol.RotateKey) (fingerprint string, verifier *auth.Verifier, reason string) {
+	pubKey, err := auth.ParseAnyPublicKey(rotate.PublicKey)
+	if err != nil {
+		return "", nil, "invalid public key"
+	}
+	if fingerprint, err = auth.Fingerprint(pubKey); err != nil {
+		return "", nil, "invalid public key"
+	}
+	if verifier, err = auth.NewVerifier(pubKey); err != nil {
+		return "", nil, "invalid public key"
+	}
+	if fingerprint == sess.fingerprint {
+		return "", nil, "new key is the current key"
+	}
+	if bans.IsBanned(fingerprint) {
+		return "", nil, "key is banned"
+	}
+	msg := auth.RotationMessage(sess.clientID, sess.rotations, rotate.PublicKey)
+	if !sess.verifier.VerifyMessage(msg, rotate.Signature) {
+		return "", nil, "invalid signature of the current key"
+	}
+	if !verifier.VerifyMessage(msg, rotate.NewSignature) {
+		return "", nil, "invalid signature of the new key"
+	}
+	return fingerprint, verifier, ""
+}
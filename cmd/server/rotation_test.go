@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Builds a rotation of the session's key to newKeys, signed as a client would
+func signRotation(t *testing.T, sess *session, oldKeys, newKeys *auth.KeyPair) protocol.RotateKey {
+	t.Helper()
+	pub, err := auth.PublicKey2Bytes(newKeys.PublicKey())
+	if err != nil {
+		t.Fatalf("PublicKey2Bytes() failed: %v", err)
+	}
+	msg := auth.RotationMessage(sess.clientID, sess.rotations, pub)
+	sig, _ := oldKeys.SignMessage(msg)
+	newSig, _ := newKeys.SignMessage(msg)
+	return protocol.RotateKey{PublicKey: pub, Signature: sig, NewSignature: newSig}
+}
+
+func newRotationSession(t *testing.T, keys *auth.KeyPair) *session {
+	t.Helper()
+	v, _ := auth.NewVerifier(keys.PublicKey())
+	fingerprint, _ := auth.Fingerprint(keys.PublicKey())
+	return &session{clientID: 7, fingerprint: fingerprint, verifier: v}
+}
+
+func TestCheckRotation(t *testing.T) {
+	setAbuse(t, abuseConfig{}) // Fresh ban list
+	oldKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	newKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	otherKeys, _ := auth.GenerateKeyPair(auth.AlgorithmRSA)
+	bannedKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	bannedFingerprint, _ := auth.Fingerprint(bannedKeys.PublicKey())
+	bans.Ban(bannedFingerprint, time.Hour)
+	sess := newRotationSession(t, oldKeys)
+
+	valid := signRotation(t, sess, oldKeys, newKeys)
+	byOther := signRotation(t, sess, otherKeys, newKeys)
+	toOther := signRotation(t, sess, oldKeys, otherKeys)
+	for _, tt := range []struct {
+		name   string
+		rotate protocol.RotateKey
+		reason string
+	}{
+		{"missing old signature", protocol.RotateKey{PublicKey: valid.PublicKey, NewSignature: valid.NewSignature}, "invalid signature of the current key"},
+		{"old signature by another key", protocol.RotateKey{PublicKey: valid.PublicKey, Signature: byOther.Signature, NewSignature: valid.NewSignature}, "invalid signature of the current key"},
+		{"missing new signature", protocol.RotateKey{PublicKey: valid.PublicKey, Signature: valid.Signature}, "invalid signature of the new key"},
+		{"new signature by another key", protocol.RotateKey{PublicKey: valid.PublicKey, Signature: valid.Signature, NewSignature: toOther.NewSignature}, "invalid signature of the new key"},
+		{"banned new key", signRotation(t, sess, oldKeys, bannedKeys), "key is banned"},
+		{"current key", signRotation(t, sess, oldKeys, oldKeys), "new key is the current key"},
+		{"invalid new key", protocol.RotateKey{PublicKey: []byte("not a key"), Signature: valid.Signature, NewSignature: valid.NewSignature}, "invalid public key"},
+		{"valid", valid, ""},
+	} {
+		fingerprint, verifier, reason := checkRotation(sess, tt.rotate)
+		if reason != tt.reason {
+			t.Errorf("%s: checkRotation() refused with %q, want %q", tt.name, reason, tt.reason)
+		}
+		if reason == "" && (fingerprint == "" || verifier == nil) {
+			t.Errorf("%s: checkRotation() accepted without the new key's fingerprint and verifier", tt.name)
+		}
+	}
+}
+
+func TestRotationCannotBeReplayed(t *testing.T) {
+	setAbuse(t, abuseConfig{})
+	firstKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	secondKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	store := &sessionStore{sessions: make(map[string]*session)}
+	sess := newRotationSession(t, firstKeys)
+	c := &clientConn{}
+
+	forward := signRotation(t, sess, firstKeys, secondKeys)
+	fingerprint, verifier, reason := checkRotation(sess, forward)
+	if reason != "" {
+		t.Fatalf("checkRotation() refused a valid rotation: %s", reason)
+	}
+	store.RotateKey(sess, c, verifier, fingerprint)
+	if sess.fingerprint != fingerprint || c.Fingerprint() != fingerprint || sess.rotations != 1 {
+		t.Errorf("RotateKey() left session key %s, connection key %s and %d rotations, want %s on both and 1", sess.fingerprint, c.Fingerprint(), sess.rotations, fingerprint)
+	}
+
+	// Rotating back needs a new rotation signed by both keys, not the replay of an older one
+	back := signRotation(t, sess, secondKeys, firstKeys)
+	sess.rotations = 0
+	staleBack := signRotation(t, sess, secondKeys, firstKeys)
+	sess.rotations = 1
+	if _, _, reason := checkRotation(sess, forward); reason == "" {
+		t.Errorf("checkRotation() accepted the replay of an applied rotation")
+	}
+	if _, _, reason := checkRotation(sess, staleBack); reason == "" {
+		t.Errorf("checkRotation() accepted a rotation signed for an older rotation count")
+	}
+	if _, _, reason := checkRotation(sess, back); reason != "" {
+		t.Errorf("checkRotation() refused rotating back with the current count: %s", reason)
+	}
+}
+
+func TestResumeAfterRotationAnswerLost(t *testing.T) {
+	setTimeouts(t, timeoutConfig{Resume: time.Minute})
+	setAbuse(t, abuseConfig{})
+	setVerifications(t, newVerifyPool(verifyConfig{Workers: 1}))
+	setRooms(t, newTestRoom(t, defaultRoom, 10, 1))
+	oldKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	newKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	oldPub, _ := auth.PublicKey2Bytes(oldKeys.PublicKey())
+	hello := protocol.Hello{Room: defaultRoom, PublicKey: oldPub}
+	welcome, conn, done := joinTestClient(t, hello)
+
+	// The connection drops once the server read the rotation, before the client got the answer
+	protocol.WriteJSON(conn, protocol.FrameRotateKey, signRotation(t, &session{clientID: welcome.ClientID}, oldKeys, newKeys))
+	conn.Close()
+	<-done
+
+	hello.ResumeToken = welcome.ResumeToken
+	resumed, conn, done := joinTestClient(t, hello)
+	if !resumed.Resumed || resumed.ClientID != welcome.ClientID || resumed.Rotations != 1 {
+		t.Fatalf("resuming with the old key = client %d, resumed %v, %d rotations, want client %d resumed after 1 rotation",
+			resumed.ClientID, resumed.Resumed, resumed.Rotations, welcome.ClientID)
+	}
+	sig, _ := newKeys.Sign(7)
+	protocol.WriteSubmit(conn, 7, sig)
+	payload, err := protocol.ReadFrameOf(conn, protocol.FrameResponse)
+	if err != nil {
+		t.Fatalf("reading response failed: %v", err)
+	}
+	if status, _ := protocol.DecodeResponse(payload); status != protocol.StatusAdded {
+		t.Errorf("response to a number signed with the new key = %d, want %d", status, protocol.StatusAdded)
+	}
+	conn.Close()
+	<-done
+
+	// The client sent a frame after learning of the rotation, the old key is refused from now on
+	if again, _, _ := joinTestClient(t, hello); again.Resumed {
+		t.Errorf("old key resumed the session after the rotation was confirmed")
+	}
+}
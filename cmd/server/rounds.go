@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/pool"
+)
+
+// Result of a single finished round
+type roundResult struct {
+	Round      int
+	Scoreboard map[int32]int // Client ID -> count
+	Numbers    []int32       // Sorted primes collected during the round
+	Start      time.Time
+	End        time.Time
+	Duration   time.Duration
+}
+
+// Tracks the current round, archived round results and cumulative standings
+type roundTracker struct {
+	mu        sync.Mutex
+	current   int // 1-based round number
+	total     int
+	start     time.Time
+	history   []roundResult
+	finished  bool          // The last round has been played
+	standings map[int32]int // Client ID -> count over all rounds
+}
+
+func newRoundTracker(total int, start time.Time) *roundTracker {
+	return &roundTracker{
+		current:   1,
+		total:     total,
+		start:     start,
+		standings: make(map[int32]int),
+	}
+}
+
+// Returns the number of the round currently being played
+func (r *roundTracker) Current() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// What became of a number submitted with roundTracker.Add
+type addOutcome int
+
+const (
+	addAccepted      addOutcome = iota // Added to the pool, which is not full yet
+	addDuplicate                       // Already in the pool
+	addStaleRound                      // Submitted in a round that is over, not counted
+	addRoomDone                        // The last round is over, not counted
+	addRoundFinished                   // Added and filled the pool, which finished the round
+)
+
+// Adds the number to the pool if round is still being played and finishes the round when the number fills the
+// pool. Both happen under the tracker's lock, so a number cannot count toward a later round than the one it was
+// submitted in, and the pool is never seen full while its round is still being played.
+// res and last are set with addRoundFinished, like with Finish.
+func (r *roundTracker) Add(p *pool.NumberPool, num, clientID int32, round int) (outcome addOutcome, res roundResult, last bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finished {
+		return addRoomDone, roundResult{}, false
+	}
+	if round != r.current {
+		return addStaleRound, roundResult{}, false
+	}
+	if !p.Add(num, clientID) {
+		return addDuplicate, roundResult{}, false
+	}
+	if p.Len() < p.Max() {
+		return addAccepted, roundResult{}, false
+	}
+	res, last = r.finish(p, round)
+	return addRoundFinished, res, last
+}
+
+// Archives the scoreboard of the given round and, unless it was the last one, resets the pool for the next round.
+// ok is false if the round was already finished by another client.
+func (r *roundTracker) Finish(p *pool.NumberPool, round int) (res roundResult, last bool, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if round != r.current || r.finished {
+		return roundResult{}, false, false
+	}
+	res, last = r.finish(p, round)
+	return res, last, true
+}
+
+// Finishes the current round, must be called with mu held
+func (r *roundTracker) finish(p *pool.NumberPool, round int) (res roundResult, last bool) {
+	now := time.Now()
+	numbers := p.Get()
+	slices.Sort(numbers)
+	res = roundResult{
+		Round:      round,
+		Scoreboard: p.GetScoreboard(),
+		Numbers:    numbers,
+		Start:      r.start,
+		End:        now,
+		Duration:   now.Sub(r.start),
+	}
+	r.history = append(r.history, res)
+	for id, count := range res.Scoreboard {
+		r.standings[id] += count
+	}
+
+	if round >= r.total {
+		r.finished = true
+		return res, true
+	}
+	p.Reset()
+	r.current++
+	r.start = now
+	return res, false
+}
+
+// Returns the round still being played as if it finished at end, ok is false once the last round was played
+func (r *roundTracker) Unfinished(p *pool.NumberPool, end time.Time) (res roundResult, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return roundResult{}, false
+	}
+	numbers := p.Get()
+	slices.Sort(numbers)
+	return roundResult{
+		Round:      r.current,
+		Scoreboard: p.GetScoreboard(),
+		Numbers:    numbers,
+		Start:      r.start,
+		End:        end,
+		Duration:   end.Sub(r.start),
+	}, true
+}
+
+// Returns a copy of the archived round results
+func (r *roundTracker) History() []roundResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]roundResult(nil), r.history...)
+}
+
+// Returns a copy of the cumulative standings
+func (r *roundTracker) Standings() map[int32]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	standings := make(map[int32]int, len(r.standings))
+	maps.Copy(standings, r.standings)
+	return standings
+}
+
+// Prints the results of a finished round of a room
+func printRoundResult(roomName string, res roundResult, total int) {
+	fmt.Printf("---ROOM %s ROUND %d/%d SCORES---\n", roomName, res.Round, total)
+	for _, id := range rankScores(res.Scoreboard) {
+		fmt.Printf("Client %d: %d numbers\n", id, res.Scoreboard[id])
+	}
+	fmt.Printf("Time taken for round %d: %v\n", res.Round, res.Duration)
+}
+
+// Returns the client IDs ordered by descending score, ties broken by ascending client ID
+func rankScores(scores map[int32]int) []int32 {
+	ids := slices.Collect(maps.Keys(scores))
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/pool"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+func TestRoundTrackerFinish(t *testing.T) {
+	p := pool.NewNumberPool(3)
+	rounds := newRoundTracker(2, time.Now())
+	p.Add(2, 1)
+	p.Add(3, 1)
+	p.Add(5, 2)
+
+	res, last, ok := rounds.Finish(p, 1)
+	if !ok || last {
+		t.Fatalf("Finish(round 1 of 2) = last %v, ok %v, want false, true", last, ok)
+	}
+	if want := map[int32]int{1: 2, 2: 1}; res.Round != 1 || !maps.Equal(res.Scoreboard, want) || len(res.Numbers) != 3 {
+		t.Errorf("Finish() archived round %d with %v and %v, want round 1 with %v and 3 numbers", res.Round, res.Scoreboard, res.Numbers, want)
+	}
+	if p.Len() != 0 || len(p.GetScoreboard()) != 0 || p.Max() != 3 {
+		t.Errorf("pool after Finish() has %d numbers, scoreboard %v and max %d, want it reset with max 3", p.Len(), p.GetScoreboard(), p.Max())
+	}
+	if rounds.Current() != 2 {
+		t.Errorf("Current() = %d after finishing round 1, want 2", rounds.Current())
+	}
+	if _, _, ok := rounds.Finish(p, 1); ok {
+		t.Errorf("Finish(round 1) succeeded twice, want the second call refused")
+	}
+
+	p.Add(7, 2)
+	res, last, ok = rounds.Finish(p, 2)
+	if !ok || !last {
+		t.Fatalf("Finish(round 2 of 2) = last %v, ok %v, want true, true", last, ok)
+	}
+	if p.Len() != 1 {
+		t.Errorf("pool after the last round has %d numbers, want the last round's 1 kept", p.Len())
+	}
+	if want := map[int32]int{1: 2, 2: 2}; !maps.Equal(rounds.Standings(), want) {
+		t.Errorf("Standings() = %v, want %v", rounds.Standings(), want)
+	}
+	if len(rounds.History()) != 2 {
+		t.Errorf("History() has %d rounds, want 2", len(rounds.History()))
+	}
+	if _, _, ok := rounds.Finish(p, 2); ok {
+		t.Errorf("Finish() succeeded after the last round")
+	}
+}
+
+func TestRoundTrackerAdd(t *testing.T) {
+	p := pool.NewNumberPool(2)
+	rounds := newRoundTracker(2, time.Now())
+	for _, tt := range []struct {
+		name    string
+		num     int32
+		round   int
+		want    addOutcome
+		current int // Round after the call
+	}{
+		{"accepted", 2, 1, addAccepted, 1},
+		{"duplicate", 2, 1, addDuplicate, 1},
+		{"fills the pool", 3, 1, addRoundFinished, 2},
+		{"admitted in the finished round", 5, 1, addStaleRound, 2},
+		{"next round", 5, 2, addAccepted, 2},
+		{"fills the last pool", 7, 2, addRoundFinished, 2},
+		{"after the last round", 11, 2, addRoomDone, 2},
+	} {
+		got, res, _ := rounds.Add(p, tt.num, 1, tt.round)
+		if got != tt.want || rounds.Current() != tt.current {
+			t.Errorf("%s: Add(%d, round %d) = %d in round %d, want %d in round %d", tt.name, tt.num, tt.round, got, rounds.Current(), tt.want, tt.current)
+		}
+		if got == addRoundFinished && res.Round != tt.round {
+			t.Errorf("%s: Add() finished round %d, want %d", tt.name, res.Round, tt.round)
+		}
+	}
+	if p.Len() != 2 {
+		t.Errorf("pool has %d numbers after the last round, want 2", p.Len())
+	}
+}
+
+func TestRoundTrackerUnfinished(t *testing.T) {
+	p := pool.NewNumberPool(2)
+	start := time.Now()
+	rounds := newRoundTracker(1, start)
+	p.Add(5, 1)
+	p.Add(2, 1)
+	res, ok := rounds.Unfinished(p, start.Add(time.Second))
+	if !ok || res.Round != 1 || res.Duration != time.Second || !slices.Equal(res.Numbers, []int32{2, 5}) {
+		t.Errorf("Unfinished() = %+v, %v, want round 1 with [2 5] over 1s", res, ok)
+	}
+	rounds.Finish(p, 1)
+	if _, ok := rounds.Unfinished(p, time.Now()); ok {
+		t.Errorf("Unfinished() succeeded after the last round")
+	}
+}
+
+func TestBatchDoesNotCountTowardTheNextRound(t *testing.T) {
+	setTimeouts(t, timeoutConfig{})
+	setVerifications(t, newVerifyPool(verifyConfig{Workers: 1}))
+	r := newTestRoom(t, defaultRoom, 2, 2)
+	setRooms(t, r)
+	keys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	pub, _ := auth.PublicKey2Bytes(keys.PublicKey())
+	_, conn, _ := joinTestClient(t, protocol.Hello{Room: defaultRoom, PublicKey: pub})
+
+	// 3 fills the pool of round 1, 5 was sent in the same round and must not count toward round 2
+	var batch []protocol.Submission
+	for _, num := range []int32{2, 3, 5} {
+		sig, _ := keys.Sign(num)
+		batch = append(batch, protocol.Submission{Num: num, Signature: sig})
+	}
+	protocol.WriteSubmitBatch(conn, batch)
+	frameType, payload, err := protocol.ReadFrame(conn)
+	for err == nil && frameType == protocol.FrameAnnouncement { // The round result comes first
+		frameType, payload, err = protocol.ReadFrame(conn)
+	}
+	if err != nil || frameType != protocol.FrameBatchResponse {
+		t.Fatalf("reading batch response got frame %d, err %v", frameType, err)
+	}
+	statuses, _ := protocol.DecodeBatchResponse(payload)
+	want := []int32{protocol.StatusAdded, protocol.StatusRoundComplete, protocol.StatusNewRound}
+	if !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if r.rounds.Current() != 2 || r.pool.Len() != 0 {
+		t.Errorf("round %d with %d numbers in the pool, want round 2 with an empty pool", r.rounds.Current(), r.pool.Len())
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+)
+
+// A client's identity in a room, kept for timeouts.Resume after its connection drops so that it can
+// reconnect with the resume token and carry on as the same client
+type session struct {
+	token       string
+	clientID    int32
+	room        *room
+	fingerprint string         // Of the client's key, guarded by the store as the key can be rotated
+	verifier    *auth.Verifier // Verifies the client's signatures, replaced with the fingerprint
+	previous    string         // Fingerprint of the key replaced by a rotation the client may not know of, guarded by the store
+
+	// Only used by the connection attached to the session, the store hands them over on resume
+	acked      uint64       // Submissions responded to, the client compares it with its own count on resume
+	lastStatus int32        // Status of the last of them
+	abuse      abuseTracker // Invalid signatures count across reconnects
+	rotations  uint64       // Keys rotated so far, signed by the next rotation so that old ones cannot be replayed
+	unit       *workUnit    // Unit leased to the client, guarded by the room's work queue
+	seen       atomic.Int64 // Unix nanoseconds of the last frame from the client, see touch
+
+	attached   bool      // A connection uses the session, guarded by the store
+	detachedAt time.Time // When the last connection dropped, guarded by the store
+}
+
+// Records that the client is alive, its work unit stays leased to it while it sends frames
+func (s *session) touch() {
+	s.seen.Store(time.Now().UnixNano())
+}
+
+func (s *session) lastSeen() time.Time {
+	return time.Unix(0, s.seen.Load())
+}
+
+// Records the response to a submission
+func (s *session) ack(status int32) {
+	s.acked++
+	s.lastStatus = status
+}
+
+// Sessions keyed by resume token
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+var sessions = &sessionStore{sessions: make(map[string]*session)}
+
+// Creates a session attached to the joining client, the token is empty if resuming is disabled
+func (s *sessionStore) Create(clientID int32, r *room, fingerprint string, verifier *auth.Verifier) (*session, error) {
+	sess := &session{clientID: clientID, room: r, fingerprint: fingerprint, verifier: verifier, attached: true}
+	sess.touch()
+	if timeouts.Resume <= 0 {
+		return sess, nil
+	}
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	sess.token = token
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	s.sessions[token] = sess
+	return sess, nil
+}
+
+// Attaches the detached session of the token, which must belong to the same key. The key replaced by
+// a rotation is accepted until the client confirms the rotation, as the connection can drop before the
+// client gets the answer. The client then learns from the welcome's rotation count that its new key is in use.
+func (s *sessionStore) Resume(token, fingerprint string) (*session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	sess, ok := s.sessions[token]
+	if !ok || sess.attached || (sess.fingerprint != fingerprint && (sess.previous == "" || sess.previous != fingerprint)) {
+		return nil, false
+	}
+	sess.attached = true
+	sess.touch()
+	return sess, true
+}
+
+// Replaces the key of the session and of its connection, a resuming client must then present the new key
+func (s *sessionStore) RotateKey(sess *session, c *clientConn, verifier *auth.Verifier, fingerprint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.verifier = verifier
+	sess.previous = sess.fingerprint
+	sess.fingerprint = fingerprint
+	sess.rotations++
+	c.setKey(verifier.PublicKey(), fingerprint)
+}
+
+// Stops accepting the key replaced by the last rotation, once the client sent a frame after the rotation's
+// answer. Its requests are answered one at a time, so it got the answer before sending the frame.
+func (s *sessionStore) ConfirmRotation(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.previous = ""
+}
+
+// Marks the session as resumable from now on, until timeouts.Resume elapses. A session that cannot be
+// resumed, because resuming is disabled or the session was deleted, releases its work unit right away.
+func (s *sessionStore) Detach(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.attached = false
+	sess.detachedAt = time.Now()
+	if _, ok := s.sessions[sess.token]; !ok {
+		sess.room.work.Release(sess)
+	}
+}
+
+// Forgets the session and releases its work unit, e.g. once its client was disconnected for abuse
+func (s *sessionStore) Delete(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sess.token)
+	sess.room.work.Release(sess)
+}
+
+// Forgets the sessions detached for longer than the resume window and releases their work units,
+// must be called with mu held
+func (s *sessionStore) prune(now time.Time) {
+	for token, sess := range s.sessions {
+		if !sess.attached && now.Sub(sess.detachedAt) > timeouts.Resume {
+			delete(s.sessions, token)
+			sess.room.work.Release(sess)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Applies the timeouts for the duration of the test
+func setTimeouts(t *testing.T, cfg timeoutConfig) {
+	t.Helper()
+	saved := timeouts
+	timeouts = cfg
+	t.Cleanup(func() { timeouts = saved })
+}
+
+func newTestSession(t *testing.T, store *sessionStore, clientID int32, fingerprint string) *session {
+	t.Helper()
+	sess, err := store.Create(clientID, newTestRoom(t, defaultRoom, 10, 1), fingerprint, nil)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	return sess
+}
+
+func TestSessionResume(t *testing.T) {
+	setTimeouts(t, timeoutConfig{Resume: time.Minute})
+	store := &sessionStore{sessions: make(map[string]*session)}
+	sess := newTestSession(t, store, 1, "key")
+	if sess.token == "" {
+		t.Fatalf("Create() returned a session without a resume token")
+	}
+	if _, ok := store.Resume(sess.token, "key"); ok {
+		t.Errorf("Resume() succeeded while the session is attached")
+	}
+	store.Detach(sess)
+
+	for _, tt := range []struct {
+		name, token, fingerprint string
+	}{
+		{"unknown token", "unknown", "key"},
+		{"empty token", "", "key"},
+		{"another key", sess.token, "other key"},
+	} {
+		if _, ok := store.Resume(tt.token, tt.fingerprint); ok {
+			t.Errorf("%s: Resume() succeeded, want it refused", tt.name)
+		}
+	}
+	resumed, ok := store.Resume(sess.token, "key")
+	if !ok || resumed != sess {
+		t.Fatalf("Resume() = %p, %v, want the detached session", resumed, ok)
+	}
+	if _, ok := store.Resume(sess.token, "key"); ok {
+		t.Errorf("Resume() succeeded twice, want the session attached to one connection")
+	}
+
+	store.Detach(sess)
+	store.Delete(sess)
+	if _, ok := store.Resume(sess.token, "key"); ok {
+		t.Errorf("Resume() succeeded after Delete()")
+	}
+}
+
+func TestSessionResumeWindow(t *testing.T) {
+	setTimeouts(t, timeoutConfig{Resume: time.Minute})
+	store := &sessionStore{sessions: make(map[string]*session)}
+	expired := newTestSession(t, store, 1, "key")
+	fresh := newTestSession(t, store, 2, "key")
+	attached := newTestSession(t, store, 3, "key")
+	store.Detach(expired)
+	store.Detach(fresh)
+	expired.detachedAt = time.Now().Add(-2 * time.Minute)
+
+	if _, ok := store.Resume(expired.token, "key"); ok {
+		t.Errorf("Resume() succeeded after the resume window")
+	}
+	store.mu.Lock()
+	store.prune(time.Now().Add(30 * time.Second))
+	_, expiredKept := store.sessions[expired.token]
+	_, freshKept := store.sessions[fresh.token]
+	_, attachedKept := store.sessions[attached.token]
+	store.prune(time.Now().Add(2 * time.Minute))
+	_, freshKeptLater := store.sessions[fresh.token]
+	_, attachedKeptLater := store.sessions[attached.token]
+	store.mu.Unlock()
+	if expiredKept || !freshKept || !attachedKept {
+		t.Errorf("prune() kept expired %v, fresh %v, attached %v, want false, true, true", expiredKept, freshKept, attachedKept)
+	}
+	if freshKeptLater || !attachedKeptLater {
+		t.Errorf("prune() after the window kept detached %v, attached %v, want false, true", freshKeptLater, attachedKeptLater)
+	}
+}
+
+func TestSessionResumeDisabled(t *testing.T) {
+	setTimeouts(t, timeoutConfig{})
+	store := &sessionStore{sessions: make(map[string]*session)}
+	sess := newTestSession(t, store, 1, "key")
+	if sess.token != "" || len(store.sessions) != 0 {
+		t.Errorf("Create() with resuming disabled returned token %q and stored %d sessions, want none", sess.token, len(store.sessions))
+	}
+}
+
+func TestSessionReleasesUnitOnceGone(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		resume time.Duration
+		leave  func(store *sessionStore, sess *session)
+		want   string // State of the session's unit
+	}{
+		{"detached", time.Minute, func(store *sessionStore, sess *session) {
+			store.Detach(sess)
+		}, "leased"},
+		{"pruned", time.Minute, func(store *sessionStore, sess *session) {
+			store.Detach(sess)
+			store.mu.Lock()
+			store.prune(time.Now().Add(2 * time.Minute))
+			store.mu.Unlock()
+		}, "abandoned"},
+		{"deleted", time.Minute, func(store *sessionStore, sess *session) {
+			store.Delete(sess)
+		}, "abandoned"},
+		{"detached with resuming disabled", 0, func(store *sessionStore, sess *session) {
+			store.Detach(sess)
+		}, "abandoned"},
+	} {
+		setTimeouts(t, timeoutConfig{Resume: tt.resume}) // Units are only reassigned once released
+		store := &sessionStore{sessions: make(map[string]*session)}
+		sess := newTestSession(t, store, 1, "key")
+		sess.room.work.Lease(sess, 100)
+		tt.leave(store, sess)
+		if got := sess.room.work.Progress().Units[0].State; got != tt.want {
+			t.Errorf("%s: unit is %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
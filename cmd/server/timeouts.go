@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// Deadlines applied to client connections, zero values disable the matching deadline
+type timeoutConfig struct {
+	Handshake time.Duration `json:"handshake"` // Time allowed to complete the handshake
+	Idle      time.Duration `json:"idle"`      // Time allowed between two frames from the client, pings included
+	Write     time.Duration `json:"write"`     // Time allowed for a single write
+	Resume    time.Duration `json:"resume"`    // Time a disconnected client has to resume its session
+	Lease     time.Duration `json:"lease"`     // Time a work unit stays leased to a client that sends no frame
+}
+
+// Encodes the durations as strings such as "1m0s" rather than nanoseconds
+func (t timeoutConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Handshake string `json:"handshake"`
+		Idle      string `json:"idle"`
+		Write     string `json:"write"`
+		Resume    string `json:"resume"`
+		Lease     string `json:"lease"`
+	}{t.Handshake.String(), t.Idle.String(), t.Write.String(), t.Resume.String(), t.Lease.String()})
+}
+
+var timeouts timeoutConfig
+
+// Sets a write deadline before every write so that a stuck client cannot block its writers
+type timeoutConn struct {
+	net.Conn
+}
+
+func (c *timeoutConn) Write(b []byte) (int, error) {
+	if timeouts.Write > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(timeouts.Write))
+	}
+	return c.Conn.Write(b)
+}
+
+// Sets the read deadline to d from now, or clears it if d is zero
+func setReadTimeout(conn net.Conn, d time.Duration) {
+	if d > 0 {
+		conn.SetReadDeadline(time.Now().Add(d))
+	} else {
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// Reports whether the error comes from an expired deadline
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
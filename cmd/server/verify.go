@@ -0,0 +1,68 @@
+package main
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+)
+
+// Sizing of the signature verification pool
+type verifyConfig struct {
+	Workers int `json:"workers"` // Goroutines verifying signatures, GOMAXPROCS if zero
+	Queue   int `json:"queue"`   // Verifications waiting for a worker, submissions beyond it are shed
+}
+
+// Fixed set of workers that verify submission signatures, so that verification cost follows the number
+// of CPUs rather than the number of connections. Connections queue jobs and wait for the result.
+type verifyPool struct {
+	jobs chan verifyJob
+}
+
+// Signatures verified together, see auth.VerifyBatch
+type verifyJob struct {
+	items  []auth.BatchItem
+	result chan<- []bool
+}
+
+// Verifies the signatures of every connection, each with the auth.Verifier of its session
+var verifications *verifyPool
+
+// Starts the workers of the pool, they run for the life of the server
+func newVerifyPool(cfg verifyConfig) *verifyPool {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &verifyPool{jobs: make(chan verifyJob, cfg.Queue)}
+	for range workers {
+		go p.work()
+	}
+	verifyWorkers.Set(float64(workers))
+	return p
+}
+
+func (p *verifyPool) work() {
+	for job := range p.jobs {
+		verifyQueueDepth.Set(float64(len(p.jobs)))
+		start := time.Now()
+		valid := auth.VerifyBatch(job.items) // Single signatures are verified alone
+		verifyLatency.Observe(time.Since(start).Seconds())
+		job.result <- valid
+	}
+}
+
+// Verifies the signatures of a batch together on one worker, a single submission is a batch of one. It does
+// not wait for room in the queue: when the queue is full the batch is shed and ok is false, the client is
+// then asked to slow down.
+func (p *verifyPool) VerifyBatch(items []auth.BatchItem) (valid []bool, ok bool) {
+	result := make(chan []bool, 1)
+	select {
+	case p.jobs <- verifyJob{items: items, result: result}:
+	default:
+		verifyShed.Add(float64(len(items)))
+		return nil, false
+	}
+	verifyQueueDepth.Set(float64(len(p.jobs)))
+	return <-result, true
+}
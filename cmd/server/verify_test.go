@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Verifies the signatures of the test's clients with p
+func setVerifications(t *testing.T, p *verifyPool) {
+	t.Helper()
+	saved := verifications
+	verifications = p
+	t.Cleanup(func() { verifications = saved })
+}
+
+// Starts a pool of one worker, blocks the worker on a job and fills the queue with another one.
+// The jobs are released when the test ends.
+func newBlockedVerifyPool(t *testing.T) *verifyPool {
+	t.Helper()
+	p := newVerifyPool(verifyConfig{Workers: 1, Queue: 1})
+	blocked := make(chan []bool)
+	p.jobs <- verifyJob{result: blocked}
+	for len(p.jobs) > 0 {
+		time.Sleep(time.Millisecond) // Wait for the worker to take the job
+	}
+	p.jobs <- verifyJob{result: blocked}
+	t.Cleanup(func() {
+		<-blocked
+		<-blocked
+	})
+	return p
+}
+
+func TestVerifyPoolShedsWhenFull(t *testing.T) {
+	p := newBlockedVerifyPool(t)
+	keys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	v, _ := auth.NewVerifier(keys.PublicKey())
+	sig, _ := keys.Sign(7)
+	items := []auth.BatchItem{{Num: 7, Signature: sig, Verifier: v}, {Num: 7, Signature: sig, Verifier: v}}
+
+	shed := verifyShed.Get()
+	if valid, ok := p.VerifyBatch(items); ok || valid != nil {
+		t.Errorf("VerifyBatch() = %v, %v with a full queue, want nil, false", valid, ok)
+	}
+	if got := verifyShed.Get() - shed; got != 2 {
+		t.Errorf("parallel_sign_verify_shed_total grew by %v, want 2", got)
+	}
+}
+
+func TestShedSubmissionGetsSlowDown(t *testing.T) {
+	setTimeouts(t, timeoutConfig{})
+	setVerifications(t, newBlockedVerifyPool(t))
+	setRooms(t, newTestRoom(t, defaultRoom, 10, 1))
+
+	keys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	pub, _ := auth.PublicKey2Bytes(keys.PublicKey())
+	_, clientConn, _ := joinTestClient(t, protocol.Hello{Room: defaultRoom, PublicKey: pub})
+	shed := verifyShed.Get()
+	sig, _ := keys.Sign(7)
+	protocol.WriteSubmit(clientConn, 7, sig)
+	payload, err := protocol.ReadFrameOf(clientConn, protocol.FrameResponse)
+	if err != nil {
+		t.Fatalf("reading response failed: %v", err)
+	}
+	if status, _ := protocol.DecodeResponse(payload); status != protocol.StatusSlowDown {
+		t.Errorf("response to a shed submission = %d, want %d", status, protocol.StatusSlowDown)
+	}
+	if got := verifyShed.Get() - shed; got != 1 {
+		t.Errorf("parallel_sign_verify_shed_total grew by %v, want 1", got)
+	}
+}
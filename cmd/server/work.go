@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/primes"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// A range of numbers searched by one client at a time
+type workUnit struct {
+	id          int64
+	rng         protocol.Range
+	holder      *session // Nil until leased and once completed or released
+	leasedAt    time.Time
+	leases      int // More than one once the unit was reassigned
+	completed   bool
+	completedBy int32
+	completedAt time.Time
+	found       int // Primes the client reported in the range
+}
+
+// Reports whether the unit can be leased to another client, because it was released or its holder went silent
+func (u *workUnit) abandoned(now time.Time) bool {
+	return u.holder == nil || (timeouts.Lease > 0 && now.Sub(u.holder.lastSeen()) > timeouts.Lease)
+}
+
+func (u *workUnit) lease() protocol.Lease {
+	return protocol.Lease{UnitID: u.id, Range: u.rng, TTL: timeouts.Lease.Milliseconds()}
+}
+
+// Work units of a room, carved from [2, primes.MaxRange) on demand and leased to one client at a time
+type workQueue struct {
+	mu    sync.Mutex
+	units []*workUnit // Ordered by ID, the unit ID is its index plus one
+	next  int64       // Start of the next unit to carve
+}
+
+func newWorkQueue() *workQueue {
+	return &workQueue{next: 2}
+}
+
+// Leases a unit of size numbers to the session: the one it already holds, else one abandoned by another client,
+// else a new one. reassigned is set in the second case, ok is false once every number is covered.
+func (q *workQueue) Lease(sess *session, size int64) (lease protocol.Lease, reassigned, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if u := sess.unit; u != nil && u.holder == sess {
+		return u.lease(), false, true
+	}
+
+	now := time.Now()
+	var unit *workUnit
+	for _, u := range q.units {
+		if !u.completed && u.abandoned(now) {
+			unit, reassigned = u, true
+			break
+		}
+	}
+	if unit == nil {
+		if q.next >= primes.MaxRange {
+			return protocol.Lease{}, false, false
+		}
+		unit = &workUnit{id: int64(len(q.units)) + 1, rng: protocol.Range{Lo: q.next, Hi: min(q.next+size, primes.MaxRange)}}
+		q.units = append(q.units, unit)
+		q.next = unit.rng.Hi
+	}
+	unit.holder, unit.leasedAt = sess, now
+	unit.leases++
+	sess.unit = unit
+	return unit.lease(), reassigned, true
+}
+
+// Records the unit as searched by the session, which must hold it. Completing a unit twice is accepted
+// so that a client can retry after a reconnect, repeated is set in that case.
+func (q *workQueue) Complete(sess *session, unitID int64, found int) (info unitInfo, repeated bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if unitID < 1 || unitID > int64(len(q.units)) {
+		return info, false, fmt.Errorf("unknown unit %d", unitID)
+	}
+	u := q.units[unitID-1]
+	if u.completed && u.completedBy == sess.clientID {
+		return u.info(u.completedAt), true, nil
+	}
+	if u.completed {
+		return info, false, fmt.Errorf("unit %d was completed by another client", unitID)
+	}
+	if u.holder != sess {
+		return info, false, fmt.Errorf("unit %d is not leased to the client", unitID)
+	}
+	u.completed, u.completedBy, u.completedAt, u.found = true, sess.clientID, time.Now(), found
+	u.holder, sess.unit = nil, nil
+	return u.info(u.completedAt), false, nil
+}
+
+// Gives up the unit of the session so that the next lease can reassign it right away. The session store
+// calls it once the client cannot come back for the unit.
+func (q *workQueue) Release(sess *session) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if u := sess.unit; u != nil && u.holder == sess {
+		u.holder = nil
+	}
+	sess.unit = nil
+}
+
+// A work unit as shown in the admin view
+type unitInfo struct {
+	ID       int64     `json:"id"`
+	Lo       int64     `json:"lo"`
+	Hi       int64     `json:"hi"`
+	State    string    `json:"state"`               // leased, abandoned or completed
+	ClientID int32     `json:"client_id,omitempty"` // Holder, or the client that completed it
+	Leases   int       `json:"leases"`
+	Found    int       `json:"found"`
+	LeasedAt time.Time `json:"leased_at"`
+	Elapsed  float64   `json:"elapsed_seconds"` // From the last lease to completion, or to now
+}
+
+// Must be called with the queue's mu held
+func (u *workUnit) info(now time.Time) unitInfo {
+	info := unitInfo{ID: u.id, Lo: u.rng.Lo, Hi: u.rng.Hi, State: "leased", Leases: u.leases, Found: u.found, LeasedAt: u.leasedAt}
+	switch {
+	case u.completed:
+		info.State, info.ClientID = "completed", u.completedBy
+		now = u.completedAt
+	case u.abandoned(now):
+		info.State = "abandoned"
+	default:
+		info.ClientID = u.holder.clientID
+	}
+	info.Elapsed = now.Sub(u.leasedAt).Seconds()
+	return info
+}
+
+// Progress of a room's work queue
+type workProgress struct {
+	Carved    int        `json:"carved"`
+	Completed int        `json:"completed"`
+	Found     int        `json:"found"`
+	Units     []unitInfo `json:"units"`
+}
+
+func (q *workQueue) Progress() workProgress {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	progress := workProgress{Carved: len(q.units), Units: make([]unitInfo, 0, len(q.units))}
+	for _, u := range q.units {
+		if u.completed {
+			progress.Completed++
+			progress.Found += u.found
+		}
+		progress.Units = append(progress.Units, u.info(now))
+	}
+	return progress
+}
+
+// Leases a unit to the client and records it, see workQueue.Lease
+func leaseUnit(r *room, sess *session, logger *slog.Logger) (protocol.Lease, bool) {
+	lease, reassigned, ok := r.work.Lease(sess, config.RangeSize)
+	if !ok {
+		logger.Info("no work unit left to lease")
+		return lease, false
+	}
+	logger.Debug("work unit leased", "unit", lease.UnitID, "lo", lease.Range.Lo, "hi", lease.Range.Hi, "reassigned", reassigned)
+	if reassigned {
+		workUnits.Inc(r.name, "reassigned")
+	}
+	workUnits.Inc(r.name, "leased")
+	return lease, true
+}
+
+// Answers a lease request or a completion
+func handleWork(c *clientConn, r *room, sess *session, frameType protocol.FrameType, payload []byte, logger *slog.Logger) error {
+	if frameType == protocol.FrameLeaseRequest {
+		lease, _ := leaseUnit(r, sess, logger)
+		return protocol.WriteJSON(c, protocol.FrameLease, lease)
+	}
+
+	var done protocol.Complete
+	if err := protocol.DecodeJSON(payload, &done); err != nil {
+		return fmt.Errorf("decoding completion: %w", err)
+	}
+	ack := protocol.CompleteAck{OK: true}
+	if info, repeated, err := r.work.Complete(sess, done.UnitID, done.Found); err != nil {
+		logger.Warn("rejected work unit completion", "unit", done.UnitID, "err", err)
+		ack = protocol.CompleteAck{Message: err.Error()}
+	} else if !repeated {
+		logger.Info("work unit completed", "unit", info.ID, "lo", info.Lo, "hi", info.Hi, "found", info.Found, "elapsed", info.Elapsed)
+		workUnits.Inc(r.name, "completed")
+	}
+	return protocol.WriteJSON(c, protocol.FrameCompleteAck, ack)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkQueue(t *testing.T) {
+	setTimeouts(t, timeoutConfig{Lease: time.Minute})
+	q := newWorkQueue()
+	alice := &session{clientID: 1}
+	bob := &session{clientID: 2}
+	alice.touch()
+	bob.touch()
+
+	first, reassigned, ok := q.Lease(alice, 100)
+	if !ok || reassigned || first.UnitID != 1 || first.Range.Lo != 2 || first.Range.Hi != 102 {
+		t.Fatalf("Lease() = %+v, %v, %v, want unit 1 over [2, 102)", first, reassigned, ok)
+	}
+	for _, tt := range []struct {
+		name string
+		sess *session
+		want int64 // Unit leased
+	}{
+		{"leasing again returns the same unit", alice, 1},
+		{"another client gets a new unit", bob, 2},
+		{"the other client leasing again", bob, 2},
+	} {
+		if lease, _, _ := q.Lease(tt.sess, 100); lease.UnitID != tt.want {
+			t.Errorf("%s: Lease() = unit %d, want %d", tt.name, lease.UnitID, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name         string
+		sess         *session
+		unit         int64
+		wantRepeated bool
+		wantErr      bool
+	}{
+		{"unknown unit", alice, 9, false, true},
+		{"unit of another client", alice, 2, false, true},
+		{"own unit", alice, 1, false, false},
+		{"own unit again", alice, 1, true, false},
+		{"unit completed by another client", bob, 1, false, true},
+	} {
+		_, repeated, err := q.Complete(tt.sess, tt.unit, 5)
+		if repeated != tt.wantRepeated || (err != nil) != tt.wantErr {
+			t.Errorf("%s: Complete(unit %d) = repeated %v, err %v, want repeated %v, error %v", tt.name, tt.unit, repeated, err, tt.wantRepeated, tt.wantErr)
+		}
+	}
+	if lease, _, _ := q.Lease(alice, 100); lease.UnitID != 3 {
+		t.Errorf("Lease() after completing = unit %d, want a new unit 3", lease.UnitID)
+	}
+}
+
+func TestWorkQueueReassignsAbandonedUnits(t *testing.T) {
+	setTimeouts(t, timeoutConfig{Lease: time.Minute})
+	q := newWorkQueue()
+	alice := &session{clientID: 1}
+	bob := &session{clientID: 2}
+	carol := &session{clientID: 3}
+	alice.touch()
+	bob.touch()
+	carol.touch()
+	q.Lease(alice, 100)
+	q.Lease(bob, 100)
+
+	// Alice goes silent for longer than the lease timeout
+	alice.seen.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	lease, reassigned, _ := q.Lease(carol, 100)
+	if lease.UnitID != 1 || !reassigned {
+		t.Errorf("Lease() = unit %d, reassigned %v once its holder went silent, want unit 1 reassigned", lease.UnitID, reassigned)
+	}
+	if _, _, err := q.Complete(alice, 1, 5); err == nil {
+		t.Errorf("Complete() by the previous holder succeeded after the unit was reassigned")
+	}
+
+	// Bob's session is gone, see TestSessionReleasesUnitOnceGone
+	q.Release(bob)
+	if lease, reassigned, _ := q.Lease(alice, 100); lease.UnitID != 2 || !reassigned {
+		t.Errorf("Lease() = unit %d, reassigned %v after a release, want unit 2 reassigned", lease.UnitID, reassigned)
+	}
+}
+
+func TestWorkQueueLeaseTimeoutDisabled(t *testing.T) {
+	setTimeouts(t, timeoutConfig{})
+	q := newWorkQueue()
+	alice := &session{clientID: 1}
+	bob := &session{clientID: 2}
+	alice.seen.Store(time.Now().Add(-time.Hour).UnixNano())
+	q.Lease(alice, 100)
+	if lease, reassigned, _ := q.Lease(bob, 100); lease.UnitID != 2 || reassigned {
+		t.Errorf("Lease() = unit %d, reassigned %v without a lease timeout, want a new unit 2", lease.UnitID, reassigned)
+	}
+}
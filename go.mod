@@ -1,3 +1,5 @@
 module github.com/omersuve/go-parallel-sign
 
 go 1.23.6
+
+require filippo.io/edwards25519 v1.1.0
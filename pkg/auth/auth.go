@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 )
@@ -64,7 +65,7 @@ func Verify(num int32, signature []byte, pub *rsa.PublicKey) bool {
 }
 
 // Serializes the public key to bytes
-func PublicKey2Bytes(pub *rsa.PublicKey) ([]byte, error) {
+func PublicKey2Bytes(pub crypto.PublicKey) ([]byte, error) {
     pubBytes, err := x509.MarshalPKIXPublicKey(pub)
     if err != nil {
         return nil, err
@@ -75,6 +76,16 @@ func PublicKey2Bytes(pub *rsa.PublicKey) ([]byte, error) {
     }), nil
 }
 
+// Returns the hex encoded SHA-256 digest of the DER encoded public key, used to identify a key
+func Fingerprint(pub crypto.PublicKey) (string, error) {
+    pubBytes, err := x509.MarshalPKIXPublicKey(pub)
+    if err != nil {
+        return "", err
+    }
+    sum := sha256.Sum256(pubBytes)
+    return hex.EncodeToString(sum[:]), nil
+}
+
 // Deserializes the public key from bytes
 func ParsePublicKey(pubBytes []byte) (*rsa.PublicKey, error) {
     block, _ := pem.Decode(pubBytes)
@@ -104,4 +104,34 @@ func TestSignWithInvalidKey(t *testing.T) {
 	} else if err.Error() != "invalid private key: nil or uninitialized" {
 		t.Errorf("Sign(%d) with uninitialized key returned wrong error: got %v, want 'invalid private key: nil or uninitialized'", num, err)
 	}
-}
\ No newline at end of file
+}
+
+func TestFingerprint(t *testing.T) {
+	keys, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() failed: %v", err)
+	}
+	other, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() failed: %v", err)
+	}
+
+	fp, err := Fingerprint(keys.PublicKey)
+	if err != nil {
+		t.Fatalf("Fingerprint() failed: %v", err)
+	}
+	if len(fp) != 64 {
+		t.Errorf("Fingerprint() length = %d, want 64", len(fp))
+	}
+
+	// The fingerprint survives serialization
+	pubBytes, _ := PublicKey2Bytes(keys.PublicKey)
+	parsedPub, _ := ParsePublicKey(pubBytes)
+	if parsedFp, _ := Fingerprint(parsedPub); parsedFp != fp {
+		t.Errorf("Fingerprint(parsed key) = %s, want %s", parsedFp, fp)
+	}
+
+	if otherFp, _ := Fingerprint(other.PublicKey); otherFp == fp {
+		t.Errorf("Fingerprint() is the same for two different keys")
+	}
+}
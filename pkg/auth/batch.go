@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/rand"
+
+	"filippo.io/edwards25519"
+)
+
+// Largest group of Ed25519 signatures verified one by one, larger groups are checked together first
+const maxSingleVerify = 3
+
+// A signed number to verify with VerifyBatch
+type BatchItem struct {
+	Num       int32
+	Signature []byte
+	Verifier  *Verifier // Verifier of the signer's key
+}
+
+// Verifies the signatures of the items and reports which ones are valid.
+// Ed25519 signatures are checked together with one multi-scalar multiplication, which costs less than
+// verifying them one by one. When the batch fails it is split in halves until the invalid signatures
+// are pinpointed. Signatures of other keys are verified one by one.
+//
+// The batch equation is cofactored like the one of Verifier.Verify, so both accept the same signatures.
+func VerifyBatch(items []BatchItem) []bool {
+	valid := make([]bool, len(items))
+	batch := make([]batchEntry, 0, len(items))
+	for i, item := range items {
+		if item.Verifier.a == nil {
+			valid[i] = item.Verifier.Verify(item.Num, item.Signature)
+			continue
+		}
+		if e, ok := parseBatchEntry(i, item.Num, item.Signature, item.Verifier); ok {
+			batch = append(batch, e)
+		}
+	}
+	verifyBatch(items, batch, valid)
+	return valid
+}
+
+// Decoded Ed25519 signature: R and s from the signature, A the public key and k the hash of R, A and the message
+type batchEntry struct {
+	index int
+	r, a  *edwards25519.Point
+	s, k  *edwards25519.Scalar
+}
+
+// Decodes the signature, fails if it cannot be valid
+func parseBatchEntry(index int, num int32, signature []byte, v *Verifier) (batchEntry, bool) {
+	r, s, ok := decodeSignature(signature)
+	if !ok {
+		return batchEntry{}, false
+	}
+	return batchEntry{index: index, r: r, a: v.a, s: s, k: v.challenge(message(num), signature)}, true
+}
+
+// Marks the entries valid if they pass together, otherwise splits them to find the invalid ones
+func verifyBatch(items []BatchItem, entries []batchEntry, valid []bool) {
+	if len(entries) <= maxSingleVerify {
+		for _, e := range entries {
+			item := items[e.index]
+			valid[e.index] = item.Verifier.Verify(item.Num, item.Signature)
+		}
+		return
+	}
+	if batchHolds(entries) {
+		for _, e := range entries {
+			valid[e.index] = true
+		}
+		return
+	}
+	half := len(entries) / 2
+	verifyBatch(items, entries[:half], valid)
+	verifyBatch(items, entries[half:], valid)
+}
+
+// Checks [8](-[sum z_i*s_i]B + sum [z_i]R_i + sum [z_i*k_i]A_i) = 0 with random 128-bit z_i, which holds for
+// valid signatures and, whatever the signatures, fails with overwhelming probability if any of them is invalid
+func batchHolds(entries []batchEntry) bool {
+	z := make([]byte, 16*len(entries))
+	if _, err := rand.Read(z); err != nil {
+		return false // Entries are verified one by one
+	}
+	scalars := make([]*edwards25519.Scalar, 0, 2*len(entries)+1)
+	points := make([]*edwards25519.Point, 0, 2*len(entries)+1)
+	sum := edwards25519.NewScalar()
+	var buf [32]byte
+	for i, e := range entries {
+		copy(buf[:16], z[16*i:])
+		zi, _ := edwards25519.NewScalar().SetCanonicalBytes(buf[:])
+		sum.MultiplyAdd(zi, e.s, sum)
+		scalars = append(scalars, zi, edwards25519.NewScalar().Multiply(zi, e.k))
+		points = append(points, e.r, e.a)
+	}
+	scalars = append(scalars, sum.Negate(sum))
+	points = append(points, edwards25519.NewGeneratorPoint())
+	check := new(edwards25519.Point).VarTimeMultiScalarMult(scalars, points)
+	return check.MultByCofactor(check).Equal(edwards25519.NewIdentityPoint()) == 1
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"slices"
+	"testing"
+
+	"filippo.io/edwards25519"
+)
+
+// Signs the numbers 0 to n-1 with a few Ed25519 keys
+func signedBatch(t testing.TB, n int) []BatchItem {
+	t.Helper()
+	var keys []*KeyPair
+	for range 3 {
+		k, err := GenerateKeyPair(AlgorithmEd25519)
+		if err != nil {
+			t.Fatalf("GenerateKeyPair(ed25519) failed: %v", err)
+		}
+		keys = append(keys, k)
+	}
+	items := make([]BatchItem, n)
+	for i := range items {
+		k := keys[i%len(keys)]
+		sig, err := k.Sign(int32(i))
+		if err != nil {
+			t.Fatalf("Sign(%d) failed: %v", i, err)
+		}
+		items[i] = BatchItem{Num: int32(i), Signature: sig, Verifier: newVerifier(t, k)}
+	}
+	return items
+}
+
+func TestVerifyBatch(t *testing.T) {
+	items := signedBatch(t, 64)
+	if valid := VerifyBatch(items); slices.Contains(valid, false) {
+		t.Errorf("VerifyBatch(valid signatures) = %v, want all true", valid)
+	}
+
+	// Invalid signatures are pinpointed among valid ones
+	bad := map[int]bool{5: true, 6: true, 40: true, 63: true}
+	items[5].Num++                                 // Signature of another number
+	items[6].Verifier = items[7].Verifier          // Signature of another key
+	items[40].Signature = items[40].Signature[:10] // Truncated
+	items[63].Signature = slices.Clone(items[63].Signature)
+	items[63].Signature[40] ^= 1
+	for i, ok := range VerifyBatch(items) {
+		if ok == bad[i] {
+			t.Errorf("VerifyBatch() reported signature %d valid = %v, want %v", i, ok, !bad[i])
+		}
+	}
+}
+
+func TestVerifyBatchMixedKeys(t *testing.T) {
+	items := signedBatch(t, 8)
+	rsaKeys, err := GenerateKeyPair(AlgorithmRSA)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair(rsa) failed: %v", err)
+	}
+	sig, _ := rsaKeys.Sign(100)
+	v := newVerifier(t, rsaKeys)
+	items = append(items, BatchItem{Num: 100, Signature: sig, Verifier: v}, BatchItem{Num: 101, Signature: sig, Verifier: v})
+	want := []bool{true, true, true, true, true, true, true, true, true, false}
+	if valid := VerifyBatch(items); !slices.Equal(valid, want) {
+		t.Errorf("VerifyBatch() = %v, want %v", valid, want)
+	}
+	if valid := VerifyBatch(nil); len(valid) != 0 {
+		t.Errorf("VerifyBatch(nil) = %v, want empty", valid)
+	}
+}
+
+// Signs the number like Ed25519 but with a point of order 2 added to R: [s]B - [k]A is then R minus that point,
+// which ed25519.Verify rejects and the cofactored equation accepts
+func signWithSmallOrderR(t *testing.T, keys *KeyPair, num int32) []byte {
+	t.Helper()
+	h := sha512.Sum512(keys.PrivateKey.(ed25519.PrivateKey).Seed())
+	a, _ := edwards25519.NewScalar().SetBytesWithClamping(h[:32])
+	nonce := make([]byte, 64)
+	rand.Read(nonce)
+	r, _ := edwards25519.NewScalar().SetUniformBytes(nonce)
+
+	order2 := make([]byte, 32) // (0, -1), encoded as y = p-1
+	order2[0], order2[31] = 0xec, 0x7f
+	for i := 1; i < 31; i++ {
+		order2[i] = 0xff
+	}
+	t2, err := new(edwards25519.Point).SetBytes(order2)
+	if err != nil {
+		t.Fatalf("decoding the point of order 2 failed: %v", err)
+	}
+	bigR := new(edwards25519.Point).ScalarBaseMult(r)
+	bigR.Add(bigR, t2)
+
+	sig := make([]byte, ed25519.SignatureSize)
+	copy(sig, bigR.Bytes())
+	k := newVerifier(t, keys).challenge(message(num), sig)
+	copy(sig[32:], edwards25519.NewScalar().MultiplyAdd(k, a, r).Bytes())
+	return sig
+}
+
+func TestSmallOrderSignatureSameWithAndWithoutBatch(t *testing.T) {
+	keys, _ := GenerateKeyPair(AlgorithmEd25519)
+	v := newVerifier(t, keys)
+	sig := signWithSmallOrderR(t, keys, 42)
+	if VerifyKey(42, sig, keys.PublicKey()) {
+		t.Fatalf("ed25519.Verify accepted the signature, want it to need the cofactored equation")
+	}
+	tampered := slices.Clone(sig)
+	tampered[40] ^= 1
+
+	for _, tt := range []struct {
+		name string
+		sig  []byte
+		want bool
+	}{{"small-order R", sig, true}, {"tampered small-order R", tampered, false}} {
+		if got := v.Verify(42, tt.sig); got != tt.want {
+			t.Errorf("%s: Verify() = %v, want %v", tt.name, got, tt.want)
+		}
+		// Large enough to be checked with the batch equation
+		items := signedBatch(t, 2*maxSingleVerify)
+		items = append(items, BatchItem{Num: 42, Signature: tt.sig, Verifier: v})
+		if got := VerifyBatch(items); got[len(got)-1] != tt.want || slices.Contains(got[:len(got)-1], false) {
+			t.Errorf("%s: VerifyBatch() = %v, want the last signature %v like Verify and the others true", tt.name, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	items := signedBatch(b, 64)
+	b.ResetTimer()
+	for i := range b.N {
+		item := items[i%len(items)]
+		item.Verifier.Verify(item.Num, item.Signature)
+	}
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	items := signedBatch(b, 64)
+	b.ResetTimer()
+	for range b.N {
+		VerifyBatch(items)
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(items)), "ns/signature")
+}
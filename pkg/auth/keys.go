@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Signature algorithm of a client key
+type Algorithm string
+
+const (
+	AlgorithmRSA     Algorithm = "rsa"     // 2048-bit RSA, PKCS #1 v1.5 signatures over SHA-256
+	AlgorithmEd25519 Algorithm = "ed25519" // Ed25519 signatures over the big-endian number
+)
+
+// Parses an algorithm name, empty means RSA
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch Algorithm(name) {
+	case "", AlgorithmRSA:
+		return AlgorithmRSA, nil
+	case AlgorithmEd25519:
+		return AlgorithmEd25519, nil
+	default:
+		return "", fmt.Errorf("unknown key algorithm %q, want rsa or ed25519", name)
+	}
+}
+
+// Holds a client key pair of any supported algorithm
+type KeyPair struct {
+	Algorithm  Algorithm
+	PrivateKey crypto.Signer // *rsa.PrivateKey or ed25519.PrivateKey
+}
+
+// Creates a new key pair for the algorithm
+func GenerateKeyPair(alg Algorithm) (*KeyPair, error) {
+	switch alg {
+	case AlgorithmRSA:
+		keys, err := GenerateKeys()
+		if err != nil {
+			return nil, err
+		}
+		return &KeyPair{Algorithm: alg, PrivateKey: keys.PrivateKey}, nil
+	case AlgorithmEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &KeyPair{Algorithm: alg, PrivateKey: priv}, nil
+	default:
+		return nil, fmt.Errorf("unknown key algorithm %q", alg)
+	}
+}
+
+func (k *KeyPair) PublicKey() crypto.PublicKey {
+	return k.PrivateKey.Public()
+}
+
+// Signs the number with the private key
+func (k *KeyPair) Sign(num int32) ([]byte, error) {
+	return k.SignMessage(message(num))
+}
+
+// Signs an arbitrary message, RSA keys sign its SHA-256 hash
+func (k *KeyPair) SignMessage(msg []byte) ([]byte, error) {
+	switch priv := k.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256(msg)
+		return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, hash[:])
+	case ed25519.PrivateKey:
+		return ed25519.Sign(priv, msg), nil
+	default:
+		return nil, errors.New("invalid private key: unsupported type")
+	}
+}
+
+// Verifies the signature with a public key of any supported algorithm
+func VerifyKey(num int32, signature []byte, pub crypto.PublicKey) bool {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return Verify(num, signature, pub)
+	case ed25519.PublicKey:
+		return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, message(num), signature)
+	default:
+		return false
+	}
+}
+
+// Deserializes a public key of any supported algorithm from bytes
+func ParseAnyPublicKey(pubBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pubBytes)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// Algorithm of a public key, empty if it is not supported
+func KeyAlgorithm(pub crypto.PublicKey) Algorithm {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return AlgorithmRSA
+	case ed25519.PublicKey:
+		return AlgorithmEd25519
+	default:
+		return ""
+	}
+}
+
+// The signed message: the number in big-endian order
+func message(num int32) []byte {
+	msg := make([]byte, 4)
+	binary.BigEndian.PutUint32(msg, uint32(num))
+	return msg
+}
+
+// Message signed by both the current and the new key of a client to rotate its key: a domain prefix,
+// which no 4-byte number message can match, the client ID and the number of rotations the session already
+// went through in big-endian order, then the new PEM public key. The count makes a captured rotation
+// useless once it was applied, it cannot be replayed to roll the key back.
+func RotationMessage(clientID int32, rotations uint64, newPublicKey []byte) []byte {
+	msg := []byte("go-parallel-sign rotate key\x00")
+	msg = binary.BigEndian.AppendUint32(msg, uint32(clientID))
+	msg = binary.BigEndian.AppendUint64(msg, rotations)
+	return append(msg, newPublicKey...)
+}
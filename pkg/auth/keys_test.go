@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	for name, want := range map[string]Algorithm{"": AlgorithmRSA, "rsa": AlgorithmRSA, "ed25519": AlgorithmEd25519} {
+		if got, err := ParseAlgorithm(name); err != nil || got != want {
+			t.Errorf("ParseAlgorithm(%q) = (%q, %v), want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseAlgorithm("dsa"); err == nil {
+		t.Errorf("ParseAlgorithm(dsa) did not fail, want error")
+	}
+}
+
+func TestKeyPairSignAndVerify(t *testing.T) {
+	for _, alg := range []Algorithm{AlgorithmRSA, AlgorithmEd25519} {
+		keys, err := GenerateKeyPair(alg)
+		if err != nil {
+			t.Fatalf("GenerateKeyPair(%s) failed: %v", alg, err)
+		}
+		sig, err := keys.Sign(42)
+		if err != nil {
+			t.Fatalf("%s Sign(42) failed: %v", alg, err)
+		}
+		if !VerifyKey(42, sig, keys.PublicKey()) {
+			t.Errorf("%s VerifyKey(42, valid signature) = false, want true", alg)
+		}
+		if VerifyKey(43, sig, keys.PublicKey()) {
+			t.Errorf("%s VerifyKey(43, signature for 42) = true, want false", alg)
+		}
+
+		// The key survives serialization and keeps its algorithm
+		pubBytes, err := PublicKey2Bytes(keys.PublicKey())
+		if err != nil {
+			t.Fatalf("%s PublicKey2Bytes() failed: %v", alg, err)
+		}
+		parsed, err := ParseAnyPublicKey(pubBytes)
+		if err != nil {
+			t.Fatalf("%s ParseAnyPublicKey() failed: %v", alg, err)
+		}
+		if KeyAlgorithm(parsed) != alg {
+			t.Errorf("KeyAlgorithm(parsed %s key) = %q", alg, KeyAlgorithm(parsed))
+		}
+		if !VerifyKey(42, sig, parsed) {
+			t.Errorf("%s VerifyKey(42) with parsed key = false, want true", alg)
+		}
+	}
+}
+
+func TestParseAnyPublicKeyUnsupported(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() failed: %v", err)
+	}
+	pubBytes, err := PublicKey2Bytes(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("PublicKey2Bytes(ecdsa) failed: %v", err)
+	}
+	if _, err := ParseAnyPublicKey(pubBytes); err == nil {
+		t.Errorf("ParseAnyPublicKey(ecdsa) did not fail, want error")
+	}
+	if VerifyKey(42, []byte("sig"), &priv.PublicKey) {
+		t.Errorf("VerifyKey() with ecdsa key = true, want false")
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+
+	"filippo.io/edwards25519"
+)
+
+// Verifies the signatures of one public key. The key is decoded once when the verifier is created
+// instead of on every signature, so a server keeps one verifier per client key.
+type Verifier struct {
+	key crypto.PublicKey
+
+	// Decoded Ed25519 key and its negation, nil for other keys
+	a, minusA *edwards25519.Point
+}
+
+// Creates the verifier of a public key of any supported algorithm
+func NewVerifier(pub crypto.PublicKey) (*Verifier, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return &Verifier{key: pub}, nil
+	case ed25519.PublicKey:
+		if len(pub) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key length %d", len(pub))
+		}
+		a, err := new(edwards25519.Point).SetBytes(pub)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ed25519 public key: %w", err)
+		}
+		return &Verifier{key: pub, a: a, minusA: new(edwards25519.Point).Negate(a)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+func (v *Verifier) PublicKey() crypto.PublicKey {
+	return v.key
+}
+
+// Verifies the signature of the number. It accepts every signature VerifyKey accepts, see VerifyMessage for
+// the Ed25519 signatures it accepts in addition.
+func (v *Verifier) Verify(num int32, signature []byte) bool {
+	return v.VerifyMessage(message(num), signature)
+}
+
+// Verifies a signature made with KeyPair.SignMessage.
+// Ed25519 signatures are checked with the cofactored equation [8]([s]B - [k]A - R) = 0 that VerifyBatch checks
+// for many signatures at once, so that a signature counts whether or not it was batched. Unlike ed25519.Verify,
+// it accepts signatures whose R has a small-order component, which only the holder of the private key can produce.
+func (v *Verifier) VerifyMessage(msg, signature []byte) bool {
+	if v.a == nil {
+		hash := sha256.Sum256(msg)
+		return rsa.VerifyPKCS1v15(v.key.(*rsa.PublicKey), crypto.SHA256, hash[:], signature) == nil
+	}
+	r, s, ok := decodeSignature(signature)
+	if !ok {
+		return false
+	}
+	check := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(v.challenge(msg, signature), v.minusA, s)
+	check.Subtract(check, r)
+	return check.MultByCofactor(check).Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// Decodes R and s from an Ed25519 signature, fails unless both are canonically encoded like ed25519.Verify requires
+func decodeSignature(signature []byte) (r *edwards25519.Point, s *edwards25519.Scalar, ok bool) {
+	if len(signature) != ed25519.SignatureSize {
+		return nil, nil, false
+	}
+	r, err := new(edwards25519.Point).SetBytes(signature[:32])
+	if err != nil || !bytes.Equal(r.Bytes(), signature[:32]) {
+		return nil, nil, false
+	}
+	s, err = edwards25519.NewScalar().SetCanonicalBytes(signature[32:])
+	if err != nil {
+		return nil, nil, false
+	}
+	return r, s, true
+}
+
+// Hash of R, the key and the message, reduced modulo the group order
+func (v *Verifier) challenge(msg, signature []byte) *edwards25519.Scalar {
+	h := sha512.New()
+	h.Write(signature[:32])
+	h.Write(v.key.(ed25519.PublicKey))
+	h.Write(msg)
+	k, _ := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	return k
+}
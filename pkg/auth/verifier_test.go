@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"slices"
+	"testing"
+)
+
+func newVerifier(t testing.TB, keys *KeyPair) *Verifier {
+	t.Helper()
+	v, err := NewVerifier(keys.PublicKey())
+	if err != nil {
+		t.Fatalf("NewVerifier(%s key) failed: %v", keys.Algorithm, err)
+	}
+	return v
+}
+
+func TestVerifierMatchesVerifyKey(t *testing.T) {
+	for _, alg := range []Algorithm{AlgorithmRSA, AlgorithmEd25519} {
+		keys, err := GenerateKeyPair(alg)
+		if err != nil {
+			t.Fatalf("GenerateKeyPair(%s) failed: %v", alg, err)
+		}
+		v := newVerifier(t, keys)
+		sig, _ := keys.Sign(42)
+		flipped := slices.Clone(sig)
+		flipped[0] ^= 1
+		for _, tt := range []struct {
+			num int32
+			sig []byte
+		}{{42, sig}, {43, sig}, {42, flipped}, {42, sig[:len(sig)-1]}, {42, nil}} {
+			if got, want := v.Verify(tt.num, tt.sig), VerifyKey(tt.num, tt.sig, keys.PublicKey()); got != want {
+				t.Errorf("%s Verify(%d, %d byte signature) = %v, want %v like VerifyKey", alg, tt.num, len(tt.sig), got, want)
+			}
+		}
+		if !v.Verify(42, sig) {
+			t.Errorf("%s Verify(42, valid signature) = false, want true", alg)
+		}
+	}
+}
+
+func TestSignAndVerifyMessage(t *testing.T) {
+	for _, alg := range []Algorithm{AlgorithmRSA, AlgorithmEd25519} {
+		keys, _ := GenerateKeyPair(alg)
+		v := newVerifier(t, keys)
+		msg := RotationMessage(7, 0, []byte("-----BEGIN PUBLIC KEY-----"))
+		sig, err := keys.SignMessage(msg)
+		if err != nil {
+			t.Fatalf("%s SignMessage() failed: %v", alg, err)
+		}
+		if !v.VerifyMessage(msg, sig) {
+			t.Errorf("%s VerifyMessage(valid signature) = false, want true", alg)
+		}
+		if v.VerifyMessage(RotationMessage(8, 0, []byte("-----BEGIN PUBLIC KEY-----")), sig) {
+			t.Errorf("%s VerifyMessage(message of another client) = true, want false", alg)
+		}
+		if v.VerifyMessage(RotationMessage(7, 1, []byte("-----BEGIN PUBLIC KEY-----")), sig) {
+			t.Errorf("%s VerifyMessage(message of the next rotation) = true, want false", alg)
+		}
+	}
+}
+
+func TestNewVerifierInvalidKey(t *testing.T) {
+	for _, pub := range []any{ed25519.PublicKey{1, 2, 3}, "key", nil} {
+		if _, err := NewVerifier(pub); err == nil {
+			t.Errorf("NewVerifier(%v) succeeded, want an error", pub)
+		}
+	}
+}
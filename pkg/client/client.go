@@ -0,0 +1,738 @@
+// Package client implements the client side of the protocol: it joins a room,
+// signs numbers and submits them to the server.
+package client
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/primes"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Configures a client
+type Config struct {
+	Addr string        // Server address, localhost:3000 if empty
+	Room string        // Room to join, "default" if empty
+	Keys *auth.KeyPair // Generated with Algorithm if nil
+
+	Algorithm auth.Algorithm // Algorithm of generated keys, RSA if empty
+	WantRange bool           // Ask the server for a work range, see protocol.Welcome.Range
+	// Attach a primality certificate to the submissions of primes, the server verifies it instead of testing the number.
+	// SubmitBatch cannot attach certificates.
+	Certify bool
+
+	// Backoff applied when the server asks to slow down or the room is paused, doubled on every consecutive request
+	MinSlowDown time.Duration // 50ms if zero
+	MaxSlowDown time.Duration // 2s if zero
+
+	// Interval between pings while nothing is submitted, a third of the server's idle timeout if zero.
+	// Negative disables the heartbeat.
+	Heartbeat time.Duration
+
+	// Attempts to reconnect when the connection drops, zero disables reconnecting. The session is resumed
+	// when the server still has it, so the client ID and scores carry over and a submission the server
+	// already processed is not sent again.
+	Reconnects int
+	// Delay before the first attempt, doubled after every failed one. Each wait is jittered between half and all of it.
+	MinReconnectDelay time.Duration // 100ms if zero
+	MaxReconnectDelay time.Duration // 5s if zero
+
+	// Called with the new welcome after reconnecting. The same restrictions as for OnAnnouncement apply.
+	OnReconnect func(protocol.Welcome)
+
+	// Called with the announcements received while waiting for a reply, announcements are dropped if nil.
+	// It runs while a request is in flight and must not call methods of the client.
+	OnAnnouncement func(protocol.Announcement)
+
+	// Called with the leaderboards received while waiting for a reply, once subscribed with SubscribeLeaderboard.
+	// The same restrictions as for OnAnnouncement apply.
+	OnLeaderboard func(protocol.Leaderboard)
+}
+
+// Returned by submissions once the server reported that the room is done
+var ErrRoomDone = errors.New("room is done")
+
+// Returned by SubmitBatch when the connection dropped after the server processed a batch, the numbers
+// counted but their statuses are unknown
+var ErrResponsesLost = errors.New("batch processed but its responses were lost")
+
+// Returned when the server rejects the handshake or closes the connection with a reason
+type RejectedError struct {
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return "server rejected the connection: " + e.Message
+}
+
+// A connection to the server that joined a room.
+// It is safe for concurrent use, requests share the connection one at a time.
+type Client struct {
+	cfg Config
+
+	connMu  sync.Mutex // Guards conn, welcome and keys, which change on reconnect or key rotation. Writers also hold mu.
+	conn    net.Conn
+	welcome protocol.Welcome
+	keys    *auth.KeyPair
+
+	mu         sync.Mutex    // Serializes request/response exchanges
+	lastActive time.Time     // End of the last exchange, guarded by mu
+	slowDown   time.Duration // Current backoff, zero while the server is not pushing back, guarded by mu
+	roomDone   bool          // The server sent StatusDone or StatusShutdown, guarded by mu
+	seq        uint64        // Submissions sent in the current session, guarded by mu
+	subscribed bool          // Leaderboard subscription to restore on reconnect, guarded by mu
+	rejected   error         // The server closed the session with a reason, it is not reconnected. Guarded by mu.
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// Connects to the server and joins the configured room
+func Dial(cfg Config) (*Client, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = "localhost:3000"
+	}
+	if cfg.Room == "" {
+		cfg.Room = "default"
+	}
+	if cfg.MinSlowDown == 0 {
+		cfg.MinSlowDown = 50 * time.Millisecond
+	}
+	if cfg.MaxSlowDown == 0 {
+		cfg.MaxSlowDown = 2 * time.Second
+	}
+	if cfg.MinReconnectDelay == 0 {
+		cfg.MinReconnectDelay = 100 * time.Millisecond
+	}
+	if cfg.MaxReconnectDelay == 0 {
+		cfg.MaxReconnectDelay = 5 * time.Second
+	}
+	keys := cfg.Keys
+	if keys == nil {
+		var err error
+		keys, err = auth.GenerateKeyPair(cmp.Or(cfg.Algorithm, auth.AlgorithmRSA))
+		if err != nil {
+			return nil, fmt.Errorf("generating keys: %w", err)
+		}
+	}
+
+	conn, err := net.Dial("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, keys: keys, cfg: cfg, done: make(chan struct{})}
+	if c.welcome, err = c.handshake(conn, ""); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.lastActive = time.Now()
+	if interval := c.heartbeatInterval(); interval > 0 {
+		go c.heartbeat(interval)
+	}
+	return c, nil
+}
+
+// Sends the hello on the connection and waits for the welcome, resuming the session of the token if not empty
+func (c *Client) handshake(conn net.Conn, resumeToken string) (protocol.Welcome, error) {
+	var welcome protocol.Welcome
+	pubBytes, err := auth.PublicKey2Bytes(c.keys.PublicKey())
+	if err != nil {
+		return welcome, fmt.Errorf("encoding public key: %w", err)
+	}
+	hello := protocol.Hello{Room: c.cfg.Room, PublicKey: pubBytes, ResumeToken: resumeToken, WantRange: c.cfg.WantRange}
+	if err := protocol.WriteJSON(conn, protocol.FrameHello, hello); err != nil {
+		return welcome, fmt.Errorf("sending hello: %w", err)
+	}
+
+	frameType, payload, err := protocol.ReadFrame(conn)
+	if err != nil {
+		return welcome, fmt.Errorf("reading welcome: %w", err)
+	}
+	if frameType == protocol.FrameError {
+		return welcome, decodeRejection(payload)
+	}
+	if frameType != protocol.FrameWelcome {
+		return welcome, fmt.Errorf("unexpected frame type %d, want welcome", frameType)
+	}
+	if err := protocol.DecodeJSON(payload, &welcome); err != nil {
+		return welcome, fmt.Errorf("decoding welcome: %w", err)
+	}
+	return welcome, nil
+}
+
+func decodeRejection(payload []byte) error {
+	var rejection protocol.Error
+	if err := protocol.DecodeJSON(payload, &rejection); err != nil {
+		return fmt.Errorf("decoding rejection: %w", err)
+	}
+	return &RejectedError{Message: rejection.Message}
+}
+
+// Client ID assigned by the server, it changes if a reconnect could not resume the session
+func (c *Client) ID() int32 {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.welcome.ClientID
+}
+
+// Room settings announced by the server in the last welcome
+func (c *Client) Welcome() protocol.Welcome {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.welcome
+}
+
+// Key pair used to sign submissions
+func (c *Client) Keys() *auth.KeyPair {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.keys
+}
+
+// Signs and submits the number and returns the server's status code.
+// When the server asks to slow down or the room is paused, the submission is retried after a growing backoff.
+func (c *Client) Submit(num int32) (int32, error) {
+	keys := c.Keys()
+	signature, err := keys.Sign(num)
+	if err != nil {
+		return 0, fmt.Errorf("signing %d: %w", num, err)
+	}
+	return c.submit(num, signature, keys)
+}
+
+// Submits a number with an already computed signature, honoring slow down requests like Submit
+func (c *Client) SubmitSigned(num int32, signature []byte) (int32, error) {
+	return c.submit(num, signature, nil)
+}
+
+// Submits the number signed with keys, which is nil if the caller signed it
+func (c *Client) submit(num int32, signature []byte, keys *auth.KeyPair) (int32, error) {
+	var cert []byte
+	if c.cfg.Certify {
+		cert = certificate(num)
+	}
+	for {
+		status, err := c.submitOnce(num, signature, cert, keys)
+		if err != nil {
+			return 0, err
+		}
+		if !retryLater(status) {
+			c.mu.Lock()
+			c.slowDown = 0
+			c.mu.Unlock()
+			return status, nil
+		}
+		c.backOff()
+	}
+}
+
+// Reports whether the number was not counted for now and should be resent after backing off
+func retryLater(status int32) bool {
+	return status == protocol.StatusSlowDown || status == protocol.StatusPaused
+}
+
+// Encoded primality certificate of num, nil if num is not prime
+func certificate(num int32) []byte {
+	cert, err := primes.Certify(num)
+	if err != nil {
+		return nil
+	}
+	data, _ := cert.MarshalBinary()
+	return data
+}
+
+func (c *Client) submitOnce(num int32, signature, cert []byte, keys *auth.KeyPair) (int32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.roomDone {
+		return 0, ErrRoomDone
+	}
+	if keys != nil && keys != c.keys {
+		// The key was rotated since the number was signed, the server only accepts the new key
+		var err error
+		if signature, err = c.keys.Sign(num); err != nil {
+			return 0, fmt.Errorf("signing %d: %w", num, err)
+		}
+	}
+	c.seq++
+	status, err := c.exchangeSubmit(num, signature, cert)
+	if err != nil && c.cfg.Reconnects > 0 && isConnError(err) {
+		if err = c.reconnect(); err != nil {
+			return 0, err
+		}
+		if c.welcome.Resumed && c.welcome.Acked >= c.seq {
+			// The server processed the submission before the connection dropped, only the response was lost
+			status = c.welcome.LastStatus
+		} else {
+			c.seq = c.welcome.Acked + 1
+			status, err = c.exchangeSubmit(num, signature, cert)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if status == protocol.StatusDone || status == protocol.StatusShutdown {
+		c.roomDone = true
+	}
+	return status, nil
+}
+
+// Sends the submission, certified if cert is not nil, and reads the response. Must be called with mu held.
+func (c *Client) exchangeSubmit(num int32, signature, cert []byte) (int32, error) {
+	var err error
+	if cert != nil {
+		err = protocol.WriteSubmitCertified(c.conn, num, signature, cert)
+	} else {
+		err = protocol.WriteSubmit(c.conn, num, signature)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("sending %d: %w", num, err)
+	}
+	payload, err := c.readReply(protocol.FrameResponse)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeResponse(payload)
+}
+
+// Signs and submits the numbers in batch frames of up to protocol.MaxBatch numbers, which the server
+// verifies together, and returns the status code of each number. Numbers the server asks to slow down,
+// or refuses while the room is paused, are resent after a growing backoff like with Submit.
+func (c *Client) SubmitBatch(nums []int32) ([]int32, error) {
+	keys := c.Keys()
+	batch := make([]protocol.Submission, len(nums))
+	for i, num := range nums {
+		signature, err := keys.Sign(num)
+		if err != nil {
+			return nil, fmt.Errorf("signing %d: %w", num, err)
+		}
+		batch[i] = protocol.Submission{Num: num, Signature: signature}
+	}
+	statuses := make([]int32, 0, len(nums))
+	for chunk := range slices.Chunk(batch, protocol.MaxBatch) {
+		got, err := c.submitChunk(chunk, keys)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, got...)
+	}
+	return statuses, nil
+}
+
+// Submits a batch frame's worth of numbers, resending the ones the server asks to slow down or refuses while paused
+func (c *Client) submitChunk(batch []protocol.Submission, keys *auth.KeyPair) ([]int32, error) {
+	statuses := make([]int32, len(batch))
+	pending := make([]int, len(batch)) // Indexes of the submissions to send
+	for i := range pending {
+		pending[i] = i
+	}
+	for {
+		resend := make([]protocol.Submission, len(pending))
+		for i, j := range pending {
+			resend[i] = batch[j]
+		}
+		got, err := c.submitBatchOnce(resend, keys)
+		if err != nil {
+			return nil, err
+		}
+		var slowed []int
+		for i, j := range pending {
+			statuses[j] = got[i]
+			if retryLater(got[i]) {
+				slowed = append(slowed, j)
+			}
+		}
+		if len(slowed) == 0 {
+			c.mu.Lock()
+			c.slowDown = 0
+			c.mu.Unlock()
+			return statuses, nil
+		}
+		pending = slowed
+		c.backOff()
+	}
+}
+
+func (c *Client) submitBatchOnce(batch []protocol.Submission, keys *auth.KeyPair) ([]int32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.roomDone {
+		return nil, ErrRoomDone
+	}
+	if keys != c.keys {
+		// The key was rotated since the numbers were signed
+		for i := range batch {
+			signature, err := c.keys.Sign(batch[i].Num)
+			if err != nil {
+				return nil, fmt.Errorf("signing %d: %w", batch[i].Num, err)
+			}
+			batch[i].Signature = signature
+		}
+	}
+	c.seq += uint64(len(batch))
+	statuses, err := c.exchangeBatch(batch)
+	if err != nil && c.cfg.Reconnects > 0 && isConnError(err) {
+		if err = c.reconnect(); err != nil {
+			return nil, err
+		}
+		if c.welcome.Resumed && c.welcome.Acked >= c.seq {
+			// The server processed the batch before the connection dropped but only the last status is known
+			return nil, ErrResponsesLost
+		}
+		c.seq = c.welcome.Acked + uint64(len(batch))
+		statuses, err = c.exchangeBatch(batch)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) != len(batch) {
+		return nil, fmt.Errorf("got %d statuses for a batch of %d numbers", len(statuses), len(batch))
+	}
+	if slices.Contains(statuses, protocol.StatusDone) || slices.Contains(statuses, protocol.StatusShutdown) {
+		c.roomDone = true
+	}
+	return statuses, nil
+}
+
+// Sends the batch and reads the statuses, must be called with mu held
+func (c *Client) exchangeBatch(batch []protocol.Submission) ([]int32, error) {
+	if err := protocol.WriteSubmitBatch(c.conn, batch); err != nil {
+		return nil, fmt.Errorf("sending batch: %w", err)
+	}
+	payload, err := c.readReply(protocol.FrameBatchResponse)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.DecodeBatchResponse(payload)
+}
+
+// Replaces the broken connection with a new one, resuming the session if the server still has it.
+// Must be called with mu held, other requests wait until the client is reconnected or gives up.
+// A client the server rejected, e.g. because it was kicked, does not come back.
+func (c *Client) reconnect() error {
+	c.conn.Close()
+	if c.rejected != nil {
+		return c.rejected
+	}
+	delay := c.cfg.MinReconnectDelay
+	var err error
+	for attempt := 0; attempt < c.cfg.Reconnects; attempt++ {
+		// Clients dropped together would otherwise all come back at the same time
+		jittered := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-c.done:
+			return net.ErrClosed
+		case <-time.After(jittered):
+		}
+		delay = min(2*delay, c.cfg.MaxReconnectDelay)
+
+		var conn net.Conn
+		if conn, err = net.Dial("tcp", c.cfg.Addr); err != nil {
+			continue
+		}
+		var welcome protocol.Welcome
+		if welcome, err = c.handshake(conn, c.welcome.ResumeToken); err != nil {
+			conn.Close()
+			if IsRejected(err) {
+				return err
+			}
+			continue
+		}
+		if c.subscribed {
+			err = protocol.WriteJSON(conn, protocol.FrameSubscribe, protocol.Subscribe{Leaderboard: true})
+			if err != nil {
+				conn.Close()
+				continue
+			}
+		}
+
+		c.connMu.Lock()
+		c.conn, c.welcome = conn, welcome
+		c.connMu.Unlock()
+		select {
+		case <-c.done: // Closed while reconnecting, Close did not see the new connection
+			conn.Close()
+			return net.ErrClosed
+		default:
+		}
+		c.lastActive = time.Now()
+		if c.cfg.OnReconnect != nil {
+			c.cfg.OnReconnect(welcome)
+		}
+		return nil
+	}
+	return fmt.Errorf("reconnecting after %d attempts: %w", c.cfg.Reconnects, err)
+}
+
+// Sends a ping and waits for the pong
+func (c *Client) Ping() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := protocol.WriteFrame(c.conn, protocol.FramePing, nil)
+	if err != nil {
+		err = fmt.Errorf("sending ping: %w", err)
+	} else {
+		_, err = c.readReply(protocol.FramePong)
+	}
+	if err != nil && c.cfg.Reconnects > 0 && isConnError(err) {
+		return c.reconnect()
+	}
+	return err
+}
+
+// Leases a work unit from the server, ok is false when the server has none left.
+// Leasing again before completing the unit returns the same unit.
+func (c *Client) Lease() (lease protocol.Lease, ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	payload, err := c.request(protocol.FrameLeaseRequest, nil, protocol.FrameLease)
+	if err != nil {
+		return lease, false, err
+	}
+	if err := protocol.DecodeJSON(payload, &lease); err != nil {
+		return lease, false, fmt.Errorf("decoding lease: %w", err)
+	}
+	return lease, lease.UnitID != 0, nil
+}
+
+// Reports the leased unit as searched, with the number of primes found in its range
+func (c *Client) Complete(unitID int64, found int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	payload, err := c.request(protocol.FrameComplete, protocol.Complete{UnitID: unitID, Found: found}, protocol.FrameCompleteAck)
+	if err != nil {
+		return err
+	}
+	var ack protocol.CompleteAck
+	if err := protocol.DecodeJSON(payload, &ack); err != nil {
+		return fmt.Errorf("decoding completion ack: %w", err)
+	}
+	if !ack.OK {
+		return fmt.Errorf("completing unit %d: %s", unitID, ack.Message)
+	}
+	return nil
+}
+
+// Replaces the key of the client with newKeys without losing its client ID or scores. The request is
+// signed by both keys so the server knows the holder of the current key agreed to the new one.
+// Numbers signed with the old key that were not sent yet are signed again with the new key.
+//
+// If the connection drops before the answer, the client resumes its session with the old key, which the
+// server still accepts when it replaced it, and learns from the welcome's rotation count whether it did.
+func (c *Client) RotateKey(newKeys *auth.KeyPair) error {
+	pubBytes, err := auth.PublicKey2Bytes(newKeys.PublicKey())
+	if err != nil {
+		return fmt.Errorf("encoding public key: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rotations := c.welcome.Rotations
+	payload, err := c.rotateKey(newKeys, pubBytes)
+	if err != nil && c.cfg.Reconnects > 0 && isConnError(err) {
+		if err = c.reconnect(); err != nil {
+			return err
+		}
+		if c.welcome.Resumed && c.welcome.Rotations > rotations {
+			// The server replaced the key before the connection dropped
+			c.connMu.Lock()
+			c.keys = newKeys
+			c.connMu.Unlock()
+			return nil
+		}
+		// Signed again, the client ID may have changed
+		payload, err = c.rotateKey(newKeys, pubBytes)
+	}
+	if err != nil {
+		return err
+	}
+	var ack protocol.RotateKeyAck
+	if err := protocol.DecodeJSON(payload, &ack); err != nil {
+		return fmt.Errorf("decoding key rotation ack: %w", err)
+	}
+	if !ack.OK {
+		return fmt.Errorf("rotating key: %s", ack.Message)
+	}
+	c.connMu.Lock()
+	c.keys = newKeys
+	c.welcome.Rotations++ // Signed by the next rotation
+	c.connMu.Unlock()
+	return nil
+}
+
+// Sends the key rotation request signed by the current and new keys. Must be called with mu held.
+func (c *Client) rotateKey(newKeys *auth.KeyPair, pubBytes []byte) ([]byte, error) {
+	msg := auth.RotationMessage(c.welcome.ClientID, c.welcome.Rotations, pubBytes)
+	signature, err := c.keys.SignMessage(msg)
+	if err != nil {
+		return nil, fmt.Errorf("signing key rotation: %w", err)
+	}
+	newSignature, err := newKeys.SignMessage(msg)
+	if err != nil {
+		return nil, fmt.Errorf("signing key rotation with the new key: %w", err)
+	}
+	rotate := protocol.RotateKey{PublicKey: pubBytes, Signature: signature, NewSignature: newSignature}
+	return c.roundTrip(protocol.FrameRotateKey, rotate, protocol.FrameRotateKeyAck)
+}
+
+// Sends a JSON request, or an empty one if v is nil, and reads the reply. The request is sent again after
+// reconnecting if the connection broke, so it must be safe to repeat. Must be called with mu held.
+func (c *Client) request(frameType protocol.FrameType, v any, want protocol.FrameType) ([]byte, error) {
+	payload, err := c.roundTrip(frameType, v, want)
+	if err != nil && c.cfg.Reconnects > 0 && isConnError(err) {
+		if err = c.reconnect(); err != nil {
+			return nil, err
+		}
+		payload, err = c.roundTrip(frameType, v, want)
+	}
+	return payload, err
+}
+
+func (c *Client) roundTrip(frameType protocol.FrameType, v any, want protocol.FrameType) ([]byte, error) {
+	var err error
+	if v == nil {
+		err = protocol.WriteFrame(c.conn, frameType, nil)
+	} else {
+		err = protocol.WriteJSON(c.conn, frameType, v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sending frame %d: %w", frameType, err)
+	}
+	return c.readReply(want)
+}
+
+// Asks the server to start or stop sending the room's leaderboard periodically, see Config.OnLeaderboard
+func (c *Client) SubscribeLeaderboard(enabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribed = enabled
+	if err := protocol.WriteJSON(c.conn, protocol.FrameSubscribe, protocol.Subscribe{Leaderboard: enabled}); err != nil {
+		return fmt.Errorf("sending subscription: %w", err)
+	}
+	return nil
+}
+
+// Reads the server's reply to a request, must be called with mu held
+func (c *Client) readReply(want protocol.FrameType) ([]byte, error) {
+	for {
+		frameType, payload, err := protocol.ReadFrame(c.conn)
+		if err != nil {
+			return nil, fmt.Errorf("reading reply: %w", err)
+		}
+		c.lastActive = time.Now()
+		switch frameType {
+		case want:
+			return payload, nil
+		case protocol.FrameError:
+			err := decodeRejection(payload)
+			if IsRejected(err) {
+				c.rejected = err
+			}
+			return nil, err
+		case protocol.FrameAnnouncement:
+			c.announce(payload)
+		case protocol.FrameLeaderboard:
+			c.leaderboard(payload)
+		case protocol.FrameResponse:
+			// Shutdown broadcast while waiting for the reply to another request
+			if status, err := protocol.DecodeResponse(payload); err == nil && status == protocol.StatusShutdown {
+				c.roomDone = true
+				return nil, ErrRoomDone
+			}
+			return nil, fmt.Errorf("unexpected frame type %d, want %d", frameType, want)
+		default:
+			return nil, fmt.Errorf("unexpected frame type %d, want %d", frameType, want)
+		}
+	}
+}
+
+func (c *Client) announce(payload []byte) {
+	if c.cfg.OnAnnouncement == nil {
+		return
+	}
+	var a protocol.Announcement
+	if err := protocol.DecodeJSON(payload, &a); err != nil {
+		return
+	}
+	c.cfg.OnAnnouncement(a)
+}
+
+func (c *Client) leaderboard(payload []byte) {
+	if c.cfg.OnLeaderboard == nil {
+		return
+	}
+	var lb protocol.Leaderboard
+	if err := protocol.DecodeJSON(payload, &lb); err != nil {
+		return
+	}
+	c.cfg.OnLeaderboard(lb)
+}
+
+func (c *Client) heartbeatInterval() time.Duration {
+	if c.cfg.Heartbeat != 0 {
+		return c.cfg.Heartbeat
+	}
+	return time.Duration(c.welcome.IdleTimeout) * time.Millisecond / 3
+}
+
+// Pings the server whenever the connection stayed idle for the interval, until the client is closed
+func (c *Client) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		idle := time.Since(c.lastActive)
+		c.mu.Unlock()
+		if idle < interval {
+			continue
+		}
+		if err := c.Ping(); err != nil && (c.cfg.Reconnects == 0 || IsRejected(err)) {
+			// The next submission reports the broken connection or the rejection
+			return
+		}
+	}
+}
+
+// Waits before retrying a submission the server pushed back on
+func (c *Client) backOff() {
+	c.mu.Lock()
+	if c.slowDown == 0 {
+		c.slowDown = c.cfg.MinSlowDown
+	} else {
+		c.slowDown = min(2*c.slowDown, c.cfg.MaxSlowDown)
+	}
+	d := c.slowDown
+	c.mu.Unlock()
+	time.Sleep(d)
+}
+
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn.Close()
+}
+
+// Reports whether the error means the connection broke, as opposed to the server rejecting a request
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// Reports whether the error is a rejection from the server
+func IsRejected(err error) bool {
+	var rejected *RejectedError
+	return errors.As(err, &rejected)
+}
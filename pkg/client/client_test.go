@@ -0,0 +1,674 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/omersuve/go-parallel-sign/pkg/auth"
+	"github.com/omersuve/go-parallel-sign/pkg/primes"
+	"github.com/omersuve/go-parallel-sign/pkg/protocol"
+)
+
+// Starts a listener on a random port and runs the serve functions for the connections in order, one at a time
+func startServer(t *testing.T, serves ...func(conn net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for _, serve := range serves {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			serve(conn)
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// Reads the hello and answers with a welcome, returns the client's public key
+func acceptHello(t *testing.T, conn net.Conn) protocol.Hello {
+	payload, err := protocol.ReadFrameOf(conn, protocol.FrameHello)
+	if err != nil {
+		t.Errorf("Server failed to read hello: %v", err)
+		return protocol.Hello{}
+	}
+	var hello protocol.Hello
+	protocol.DecodeJSON(payload, &hello)
+	protocol.WriteJSON(conn, protocol.FrameWelcome, protocol.Welcome{ClientID: 7, Room: hello.Room, Max: 10, Rule: "prime", Rounds: 1})
+	return hello
+}
+
+func TestDialAndSubmit(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		hello := acceptHello(t, conn)
+		pub, err := auth.ParsePublicKey(hello.PublicKey)
+		if err != nil {
+			t.Errorf("Server failed to parse public key: %v", err)
+			return
+		}
+		payload, err := protocol.ReadFrameOf(conn, protocol.FrameSubmit)
+		if err != nil {
+			t.Errorf("Server failed to read submission: %v", err)
+			return
+		}
+		num, sig, _ := protocol.DecodeSubmit(payload)
+		if num != 13 || !auth.Verify(num, sig, pub) {
+			t.Errorf("Server received %d with invalid signature, want 13 signed", num)
+		}
+		protocol.WriteResponse(conn, protocol.StatusAdded)
+	})
+
+	c, err := Dial(Config{Addr: addr, Room: "red"})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+	if c.ID() != 7 || c.Welcome().Room != "red" {
+		t.Errorf("Dial() welcome = %+v, want client 7 in room red", c.Welcome())
+	}
+
+	status, err := c.Submit(13)
+	if err != nil {
+		t.Fatalf("Submit(13) failed: %v", err)
+	}
+	if status != protocol.StatusAdded {
+		t.Errorf("Submit(13) = %d, want %d", status, protocol.StatusAdded)
+	}
+}
+
+func TestSubmitCertified(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+		payload, err := protocol.ReadFrameOf(conn, protocol.FrameSubmitCertified)
+		if err != nil {
+			t.Errorf("Server failed to read certified submission: %v", err)
+			return
+		}
+		num, _, data, _ := protocol.DecodeSubmitCertified(payload)
+		var cert primes.Certificate
+		if err := cert.UnmarshalBinary(data); err != nil || cert.Verify(num) != nil {
+			t.Errorf("Server received %d without a valid certificate", num)
+		}
+		protocol.WriteResponse(conn, protocol.StatusAdded)
+		// Numbers that are not prime have no certificate and are submitted as usual
+		if num := readSubmit(t, conn); num != 91 {
+			t.Errorf("Server received %d, want 91", num)
+		}
+		protocol.WriteResponse(conn, protocol.StatusInvalidNumber)
+	})
+
+	c, err := Dial(Config{Addr: addr, Heartbeat: -1, Certify: true})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+	if status, err := c.Submit(1000003); err != nil || status != protocol.StatusAdded {
+		t.Errorf("Submit(1000003) = (%d, %v), want (%d, nil)", status, err, protocol.StatusAdded)
+	}
+	if status, err := c.Submit(91); err != nil || status != protocol.StatusInvalidNumber {
+		t.Errorf("Submit(91) = (%d, %v), want (%d, nil)", status, err, protocol.StatusInvalidNumber)
+	}
+}
+
+func TestSubmitBatch(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		hello := acceptHello(t, conn)
+		pub, _ := auth.ParseAnyPublicKey(hello.PublicKey)
+		payload, err := protocol.ReadFrameOf(conn, protocol.FrameSubmitBatch)
+		if err != nil {
+			t.Errorf("Server failed to read batch: %v", err)
+			return
+		}
+		batch, _ := protocol.DecodeSubmitBatch(payload)
+		if len(batch) != 3 || batch[1].Num != 5 || !auth.VerifyKey(batch[1].Num, batch[1].Signature, pub) {
+			t.Errorf("Server received %v, want 3 signed numbers", batch)
+		}
+		protocol.WriteBatchResponse(conn, []int32{protocol.StatusAdded, protocol.StatusSlowDown, protocol.StatusDuplicate})
+		// Only the number the server asked to slow down is resent
+		payload, _ = protocol.ReadFrameOf(conn, protocol.FrameSubmitBatch)
+		if batch, _ = protocol.DecodeSubmitBatch(payload); len(batch) != 1 || batch[0].Num != 5 {
+			t.Errorf("Server received %v, want 5 resent alone", batch)
+		}
+		protocol.WriteBatchResponse(conn, []int32{protocol.StatusAdded})
+	})
+
+	c, err := Dial(Config{Addr: addr, Heartbeat: -1, Algorithm: auth.AlgorithmEd25519, MinSlowDown: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+	statuses, err := c.SubmitBatch([]int32{3, 5, 7})
+	if err != nil {
+		t.Fatalf("SubmitBatch() failed: %v", err)
+	}
+	if want := []int32{protocol.StatusAdded, protocol.StatusAdded, protocol.StatusDuplicate}; !slices.Equal(statuses, want) {
+		t.Errorf("SubmitBatch() = %v, want %v", statuses, want)
+	}
+}
+
+func TestSubmitHonorsSlowDown(t *testing.T) {
+	received := make(chan time.Time, 3)
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+		// A paused room is backed off from like a slow down
+		for _, status := range []int32{protocol.StatusSlowDown, protocol.StatusPaused, protocol.StatusDuplicate} {
+			if _, err := protocol.ReadFrameOf(conn, protocol.FrameSubmit); err != nil {
+				t.Errorf("Server failed to read submission: %v", err)
+				return
+			}
+			received <- time.Now()
+			protocol.WriteResponse(conn, status)
+		}
+	})
+
+	c, err := Dial(Config{Addr: addr, MinSlowDown: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	status, err := c.Submit(13)
+	if err != nil {
+		t.Fatalf("Submit(13) failed: %v", err)
+	}
+	if status != protocol.StatusDuplicate {
+		t.Errorf("Submit(13) = %d, want %d after a slow down and a pause", status, protocol.StatusDuplicate)
+	}
+
+	first, second, third := <-received, <-received, <-received
+	if d := second.Sub(first); d < 20*time.Millisecond {
+		t.Errorf("first retry after %v, want at least 20ms", d)
+	}
+	if d := third.Sub(second); d < 40*time.Millisecond {
+		t.Errorf("second retry after %v, want at least 40ms", d)
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		protocol.ReadFrameOf(conn, protocol.FrameHello)
+		protocol.WriteJSON(conn, protocol.FrameError, protocol.Error{Message: "unknown room"})
+	})
+
+	_, err := Dial(Config{Addr: addr, Room: "nope"})
+	if !IsRejected(err) {
+		t.Fatalf("Dial() error = %v, want rejection", err)
+	}
+	if err.(*RejectedError).Message != "unknown room" {
+		t.Errorf("Dial() rejection = %q, want %q", err.(*RejectedError).Message, "unknown room")
+	}
+}
+
+func TestHeartbeatPingsIdleConnection(t *testing.T) {
+	pinged := make(chan struct{})
+	addr := startServer(t, func(conn net.Conn) {
+		protocol.ReadFrameOf(conn, protocol.FrameHello)
+		protocol.WriteJSON(conn, protocol.FrameWelcome, protocol.Welcome{ClientID: 7, IdleTimeout: 60})
+		if _, err := protocol.ReadFrameOf(conn, protocol.FramePing); err != nil {
+			t.Errorf("Server failed to read ping: %v", err)
+			return
+		}
+		protocol.WriteFrame(conn, protocol.FramePong, nil)
+		close(pinged)
+	})
+
+	c, err := Dial(Config{Addr: addr})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("client did not ping an idle connection")
+	}
+}
+
+func TestAnnouncementsBeforeResponse(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+		if _, err := protocol.ReadFrameOf(conn, protocol.FrameSubmit); err != nil {
+			t.Errorf("Server failed to read submission: %v", err)
+			return
+		}
+		protocol.WriteJSON(conn, protocol.FrameAnnouncement, protocol.Announcement{Kind: protocol.AnnounceMessage, Message: "hello"})
+		protocol.WriteJSON(conn, protocol.FrameAnnouncement, protocol.Announcement{Kind: protocol.AnnounceRoundResult, Round: 1})
+		protocol.WriteResponse(conn, protocol.StatusAdded)
+	})
+
+	var got []protocol.Announcement
+	c, err := Dial(Config{Addr: addr, OnAnnouncement: func(a protocol.Announcement) { got = append(got, a) }})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	status, err := c.Submit(13)
+	if err != nil {
+		t.Fatalf("Submit(13) failed: %v", err)
+	}
+	if status != protocol.StatusAdded {
+		t.Errorf("Submit(13) = %d, want %d", status, protocol.StatusAdded)
+	}
+	if len(got) != 2 || got[0].Message != "hello" || got[1].Round != 1 {
+		t.Errorf("announcements = %+v, want the message then the round 1 result", got)
+	}
+}
+
+func TestSubscribeLeaderboard(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+		payload, err := protocol.ReadFrameOf(conn, protocol.FrameSubscribe)
+		if err != nil {
+			t.Errorf("Server failed to read subscription: %v", err)
+			return
+		}
+		var sub protocol.Subscribe
+		if protocol.DecodeJSON(payload, &sub); !sub.Leaderboard {
+			t.Errorf("Server received %+v, want leaderboard subscription", sub)
+		}
+		if _, err := protocol.ReadFrameOf(conn, protocol.FrameSubmit); err != nil {
+			t.Errorf("Server failed to read submission: %v", err)
+			return
+		}
+		you := protocol.LeaderboardEntry{ClientID: 7, Rank: 1, Score: 1, Accepted: 1}
+		protocol.WriteJSON(conn, protocol.FrameLeaderboard, protocol.Leaderboard{Clients: 1, Top: []protocol.LeaderboardEntry{you}, You: &you})
+		protocol.WriteResponse(conn, protocol.StatusAdded)
+	})
+
+	var got []protocol.Leaderboard
+	c, err := Dial(Config{Addr: addr, OnLeaderboard: func(lb protocol.Leaderboard) { got = append(got, lb) }})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.SubscribeLeaderboard(true); err != nil {
+		t.Fatalf("SubscribeLeaderboard(true) failed: %v", err)
+	}
+	if _, err := c.Submit(13); err != nil {
+		t.Fatalf("Submit(13) failed: %v", err)
+	}
+	if len(got) != 1 || got[0].You == nil || got[0].You.Rank != 1 {
+		t.Errorf("leaderboards = %+v, want one ranking the client first", got)
+	}
+}
+
+func TestConcurrentSubmit(t *testing.T) {
+	const workers, perWorker = 4, 5
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+		for i := 0; i < workers*perWorker; i++ {
+			if _, err := protocol.ReadFrameOf(conn, protocol.FrameSubmit); err != nil {
+				t.Errorf("Server failed to read submission %d: %v", i, err)
+				return
+			}
+			protocol.WriteResponse(conn, protocol.StatusAdded)
+		}
+	})
+
+	c, err := Dial(Config{Addr: addr})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := 0; i < perWorker; i++ {
+				if _, err := c.Submit(int32(i)); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for w := 0; w < workers; w++ {
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent Submit() failed: %v", err)
+		}
+	}
+}
+
+func TestSubmitAfterShutdown(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+		protocol.ReadFrameOf(conn, protocol.FrameSubmit)
+		protocol.WriteResponse(conn, protocol.StatusShutdown)
+	})
+
+	c, err := Dial(Config{Addr: addr})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	if status, err := c.Submit(13); err != nil || status != protocol.StatusShutdown {
+		t.Fatalf("Submit(13) = (%d, %v), want shutdown", status, err)
+	}
+	if _, err := c.Submit(17); !errors.Is(err, ErrRoomDone) {
+		t.Errorf("Submit(17) after shutdown error = %v, want ErrRoomDone", err)
+	}
+}
+
+// Reads a submission and reports its number
+func readSubmit(t *testing.T, conn net.Conn) int32 {
+	payload, err := protocol.ReadFrameOf(conn, protocol.FrameSubmit)
+	if err != nil {
+		t.Errorf("Server failed to read submission: %v", err)
+		return 0
+	}
+	num, _, _ := protocol.DecodeSubmit(payload)
+	return num
+}
+
+// Reads the hello on a reconnection and answers with the welcome, returns the resume token the client sent
+func acceptResume(t *testing.T, conn net.Conn, welcome protocol.Welcome) string {
+	payload, err := protocol.ReadFrameOf(conn, protocol.FrameHello)
+	if err != nil {
+		t.Errorf("Server failed to read hello: %v", err)
+		return ""
+	}
+	var hello protocol.Hello
+	protocol.DecodeJSON(payload, &hello)
+	protocol.WriteJSON(conn, protocol.FrameWelcome, welcome)
+	return hello.ResumeToken
+}
+
+func TestReconnectResumesSession(t *testing.T) {
+	addr := startServer(t,
+		func(conn net.Conn) {
+			acceptResume(t, conn, protocol.Welcome{ClientID: 7, Room: "red", ResumeToken: "token"})
+			readSubmit(t, conn) // Processed, but the connection drops before the response
+		},
+		func(conn net.Conn) {
+			if token := acceptResume(t, conn, protocol.Welcome{ClientID: 7, Room: "red", ResumeToken: "token",
+				Resumed: true, Acked: 1, LastStatus: protocol.StatusAdded}); token != "token" {
+				t.Errorf("Reconnection resume token = %q, want %q", token, "token")
+			}
+			if num := readSubmit(t, conn); num != 17 {
+				t.Errorf("Server received %d after resuming, want 17 as 13 was already processed", num)
+			}
+			protocol.WriteResponse(conn, protocol.StatusDuplicate)
+		})
+
+	var reconnects int
+	c, err := Dial(Config{Addr: addr, Room: "red", Heartbeat: -1, Reconnects: 3, MinReconnectDelay: time.Millisecond,
+		OnReconnect: func(protocol.Welcome) { reconnects++ }})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	if status, err := c.Submit(13); err != nil || status != protocol.StatusAdded {
+		t.Errorf("Submit(13) = %d, %v, want the status of the resumed session %d", status, err, protocol.StatusAdded)
+	}
+	if status, err := c.Submit(17); err != nil || status != protocol.StatusDuplicate {
+		t.Errorf("Submit(17) = %d, %v, want %d", status, err, protocol.StatusDuplicate)
+	}
+	if reconnects != 1 || c.ID() != 7 {
+		t.Errorf("Reconnected %d times as client %d, want once as client 7", reconnects, c.ID())
+	}
+}
+
+func TestReconnectResendsUnprocessedSubmission(t *testing.T) {
+	addr := startServer(t,
+		func(conn net.Conn) {
+			acceptResume(t, conn, protocol.Welcome{ClientID: 7, Room: "red", ResumeToken: "token"})
+			// Dropped before the submission arrives
+		},
+		func(conn net.Conn) {
+			// The session is gone, the client joins as a new one
+			acceptResume(t, conn, protocol.Welcome{ClientID: 8, Room: "red", ResumeToken: "other"})
+			if num := readSubmit(t, conn); num != 13 {
+				t.Errorf("Server received %d after reconnecting, want 13 resent", num)
+			}
+			protocol.WriteResponse(conn, protocol.StatusAdded)
+		})
+
+	c, err := Dial(Config{Addr: addr, Room: "red", Heartbeat: -1, Reconnects: 3, MinReconnectDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	time.Sleep(50 * time.Millisecond) // Let the server drop the first connection
+	if status, err := c.Submit(13); err != nil || status != protocol.StatusAdded {
+		t.Errorf("Submit(13) = %d, %v, want %d", status, err, protocol.StatusAdded)
+	}
+	if c.ID() != 8 {
+		t.Errorf("ID() = %d after a new session, want 8", c.ID())
+	}
+}
+
+func TestNoReconnectByDefault(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+	})
+
+	c, err := Dial(Config{Addr: addr, Heartbeat: -1})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.Submit(13); err == nil {
+		t.Error("Submit() on a dropped connection succeeded without reconnecting")
+	}
+}
+
+func TestNoReconnectAfterRejection(t *testing.T) {
+	reconnected := make(chan struct{}, 1)
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+		// Kicked, the submission sent meanwhile gets the rejection
+		protocol.WriteJSON(conn, protocol.FrameError, protocol.Error{Message: "kicked by the server"})
+		protocol.ReadFrameOf(conn, protocol.FrameSubmit)
+	}, func(conn net.Conn) {
+		reconnected <- struct{}{}
+		acceptHello(t, conn)
+	})
+
+	c, err := Dial(Config{Addr: addr, Heartbeat: -1, Reconnects: 3, MinReconnectDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Submit(13); !IsRejected(err) {
+		t.Fatalf("Submit() error = %v, want rejection", err)
+	}
+	if _, err := c.Submit(17); !IsRejected(err) {
+		t.Errorf("Submit() after the rejection error = %v, want the rejection", err)
+	}
+	select {
+	case <-reconnected:
+		t.Errorf("client reconnected after the server rejected it")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDialWantRange(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		payload, err := protocol.ReadFrameOf(conn, protocol.FrameHello)
+		if err != nil {
+			t.Errorf("Server failed to read hello: %v", err)
+			return
+		}
+		var hello protocol.Hello
+		protocol.DecodeJSON(payload, &hello)
+		if !hello.WantRange {
+			t.Error("Hello did not ask for a range")
+		}
+		protocol.WriteJSON(conn, protocol.FrameWelcome, protocol.Welcome{ClientID: 7, Range: &protocol.Range{Lo: 2, Hi: 1000}})
+		protocol.ReadFrame(conn) // Wait for the client to close
+	})
+
+	c, err := Dial(Config{Addr: addr, Heartbeat: -1, WantRange: true})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+	if r := c.Welcome().Range; r == nil || *r != (protocol.Range{Lo: 2, Hi: 1000}) {
+		t.Errorf("Welcome().Range = %v, want [2, 1000)", r)
+	}
+}
+
+func TestLeaseAndComplete(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		acceptHello(t, conn)
+		if _, err := protocol.ReadFrameOf(conn, protocol.FrameLeaseRequest); err != nil {
+			t.Errorf("Server failed to read lease request: %v", err)
+			return
+		}
+		protocol.WriteJSON(conn, protocol.FrameLease, protocol.Lease{UnitID: 4, Range: protocol.Range{Lo: 100, Hi: 200}, TTL: 60000})
+
+		for _, ack := range []protocol.CompleteAck{{OK: true}, {Message: "unknown unit 5"}} {
+			payload, err := protocol.ReadFrameOf(conn, protocol.FrameComplete)
+			if err != nil {
+				t.Errorf("Server failed to read completion: %v", err)
+				return
+			}
+			var done protocol.Complete
+			protocol.DecodeJSON(payload, &done)
+			if ack.OK && done != (protocol.Complete{UnitID: 4, Found: 21}) {
+				t.Errorf("Server received completion %+v, want unit 4 with 21 primes", done)
+			}
+			protocol.WriteJSON(conn, protocol.FrameCompleteAck, ack)
+		}
+
+		if _, err := protocol.ReadFrameOf(conn, protocol.FrameLeaseRequest); err != nil {
+			t.Errorf("Server failed to read lease request: %v", err)
+			return
+		}
+		protocol.WriteJSON(conn, protocol.FrameLease, protocol.Lease{})
+	})
+
+	c, err := Dial(Config{Addr: addr, Heartbeat: -1})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+
+	lease, ok, err := c.Lease()
+	if err != nil || !ok || lease.UnitID != 4 || lease.Range != (protocol.Range{Lo: 100, Hi: 200}) {
+		t.Fatalf("Lease() = %+v, %v, %v, want unit 4 over [100, 200)", lease, ok, err)
+	}
+	if err := c.Complete(4, 21); err != nil {
+		t.Errorf("Complete(4) failed: %v", err)
+	}
+	if err := c.Complete(5, 0); err == nil {
+		t.Error("Complete(5) succeeded, want the server's rejection")
+	}
+	if _, ok, err := c.Lease(); err != nil || ok {
+		t.Errorf("Lease() = %v, %v once the server has no unit left, want false, nil", ok, err)
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	addr := startServer(t, func(conn net.Conn) {
+		hello := acceptHello(t, conn)
+		oldPub, _ := auth.ParseAnyPublicKey(hello.PublicKey)
+		oldVerifier, _ := auth.NewVerifier(oldPub)
+		for _, ok := range []bool{false, true} {
+			payload, err := protocol.ReadFrameOf(conn, protocol.FrameRotateKey)
+			if err != nil {
+				t.Errorf("Server failed to read key rotation: %v", err)
+				return
+			}
+			var rotate protocol.RotateKey
+			protocol.DecodeJSON(payload, &rotate)
+			newPub, _ := auth.ParseAnyPublicKey(rotate.PublicKey)
+			newVerifier, _ := auth.NewVerifier(newPub)
+			// Only the accepted rotation counts
+			msg := auth.RotationMessage(7, 0, rotate.PublicKey)
+			if !oldVerifier.VerifyMessage(msg, rotate.Signature) || !newVerifier.VerifyMessage(msg, rotate.NewSignature) {
+				t.Errorf("Server received a key rotation not signed by both keys")
+			}
+			protocol.WriteJSON(conn, protocol.FrameRotateKeyAck, protocol.RotateKeyAck{OK: ok, Message: "key is banned"})
+			if ok {
+				oldVerifier = newVerifier
+			}
+		}
+		payload, _ := protocol.ReadFrameOf(conn, protocol.FrameSubmit)
+		if num, sig, _ := protocol.DecodeSubmit(payload); !oldVerifier.Verify(num, sig) {
+			t.Errorf("Server received %d not signed by the new key", num)
+		}
+		protocol.WriteResponse(conn, protocol.StatusAdded)
+	})
+
+	c, err := Dial(Config{Addr: addr, Heartbeat: -1, Algorithm: auth.AlgorithmEd25519})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+	oldKeys := c.Keys()
+	newKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	if err := c.RotateKey(newKeys); err == nil || c.Keys() != oldKeys {
+		t.Errorf("RotateKey() = %v when the server refuses, want an error and the old key kept", err)
+	}
+	if err := c.RotateKey(newKeys); err != nil {
+		t.Fatalf("RotateKey() failed: %v", err)
+	}
+	if c.Keys() != newKeys || c.Welcome().Rotations != 1 {
+		t.Errorf("Keys() did not return the new key or the rotation was not counted after RotateKey()")
+	}
+	if status, err := c.Submit(13); err != nil || status != protocol.StatusAdded {
+		t.Errorf("Submit(13) = %d, %v, want %d", status, err, protocol.StatusAdded)
+	}
+}
+
+func TestRotateKeyAnswerLost(t *testing.T) {
+	var newVerifier *auth.Verifier
+	addr := startServer(t,
+		func(conn net.Conn) {
+			acceptResume(t, conn, protocol.Welcome{ClientID: 7, ResumeToken: "token"})
+			payload, err := protocol.ReadFrameOf(conn, protocol.FrameRotateKey)
+			if err != nil {
+				t.Errorf("Server failed to read key rotation: %v", err)
+				return
+			}
+			var rotate protocol.RotateKey
+			protocol.DecodeJSON(payload, &rotate)
+			newPub, _ := auth.ParseAnyPublicKey(rotate.PublicKey)
+			newVerifier, _ = auth.NewVerifier(newPub)
+			// Rotated, but the connection drops before the answer
+		},
+		func(conn net.Conn) {
+			acceptResume(t, conn, protocol.Welcome{ClientID: 7, ResumeToken: "token", Resumed: true, Rotations: 1})
+			payload, _ := protocol.ReadFrameOf(conn, protocol.FrameSubmit)
+			if num, sig, _ := protocol.DecodeSubmit(payload); newVerifier == nil || !newVerifier.Verify(num, sig) {
+				t.Errorf("Server received %d not signed by the new key", num)
+			}
+			protocol.WriteResponse(conn, protocol.StatusAdded)
+		})
+
+	c, err := Dial(Config{Addr: addr, Heartbeat: -1, Algorithm: auth.AlgorithmEd25519, Reconnects: 3, MinReconnectDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer c.Close()
+	newKeys, _ := auth.GenerateKeyPair(auth.AlgorithmEd25519)
+	if err := c.RotateKey(newKeys); err != nil {
+		t.Fatalf("RotateKey() failed: %v", err)
+	}
+	if c.Keys() != newKeys || c.ID() != 7 || c.Welcome().Rotations != 1 {
+		t.Errorf("after RotateKey() client %d uses the new key %v with %d rotations, want client 7 with the new key and 1",
+			c.ID(), c.Keys() == newKeys, c.Welcome().Rotations)
+	}
+	if status, err := c.Submit(13); err != nil || status != protocol.StatusAdded {
+		t.Errorf("Submit(13) = %d, %v, want %d", status, err, protocol.StatusAdded)
+	}
+}
@@ -0,0 +1,130 @@
+// Package logging builds log/slog loggers shared by the server and client binaries.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Configures a logger
+type Options struct {
+	Level  string // debug, info, warn or error
+	Format string // text or json
+	Sample int    // Per second, log the first Sample records of a message then every Sample-th one, 0 disables sampling
+}
+
+// Creates a logger writing to w
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		h = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		h = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	if opts.Sample > 0 {
+		h = NewSamplingHandler(h, opts.Sample, opts.Sample, time.Second)
+	}
+	return slog.New(h), nil
+}
+
+// Parses a level name, an empty name means info
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// Occurrences of a message during the current interval
+type sampleCounter struct {
+	start time.Time
+	count int
+}
+
+// State shared by a sampling handler and the handlers derived from it
+type sampler struct {
+	first, every int
+	tick         time.Duration
+	now          func() time.Time
+
+	mu       sync.Mutex
+	counters map[string]*sampleCounter // Message -> occurrences
+}
+
+// Reports whether a record with the given message is logged
+func (s *sampler) allow(msg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	c, ok := s.counters[msg]
+	if !ok || now.Sub(c.start) >= s.tick {
+		c = &sampleCounter{start: now}
+		s.counters[msg] = c
+	}
+	c.count++
+	if c.count <= s.first {
+		return true
+	}
+	return (c.count-s.first)%s.every == 0
+}
+
+// Drops high-volume records: per tick, records below warn level are logged for the first
+// occurrences of a message, then only every so often. Warnings and errors are never dropped.
+type SamplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+func NewSamplingHandler(next slog.Handler, first, every int, tick time.Duration) *SamplingHandler {
+	if every < 1 {
+		every = 1
+	}
+	return &SamplingHandler{
+		next: next,
+		sampler: &sampler{
+			first:    first,
+			every:    every,
+			tick:     tick,
+			now:      time.Now,
+			counters: make(map[string]*sampleCounter),
+		},
+	}
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn && !h.sampler.allow(r.Message) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
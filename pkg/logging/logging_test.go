@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "warn", Format: "json"})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "client_id", 3)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("New(warn) logged %d lines, want 1: %q", len(lines), buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("New(json) produced invalid JSON %q: %v", lines[0], err)
+	}
+	if record["msg"] != "shown" || record["client_id"] != float64(3) {
+		t.Errorf("New(json) record = %v, want msg=shown client_id=3", record)
+	}
+
+	if _, err := New(&buf, Options{Format: "xml"}); err == nil {
+		t.Errorf("New(xml) did not fail, want error")
+	}
+	if _, err := New(&buf, Options{Level: "loud"}); err == nil {
+		t.Errorf("New(loud) did not fail, want error")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		s    string
+		want slog.Level
+	}{
+		{"", slog.LevelInfo},
+		{"debug", slog.LevelDebug},
+		{"INFO", slog.LevelInfo},
+		{"warn", slog.LevelWarn},
+		{"error", slog.LevelError},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLevel(%q) = (%v, %v), want (%v, nil)", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestSamplingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewSamplingHandler(slog.NewTextHandler(&buf, nil), 2, 3, time.Second)
+	now := time.Unix(0, 0)
+	h.sampler.now = func() time.Time { return now }
+	logger := slog.New(h).With("client_id", 1)
+
+	// First 2 pass, then every 3rd: occurrences 1, 2, 5, 8
+	for range 9 {
+		logger.Info("accepted")
+	}
+	if got := strings.Count(buf.String(), "msg=accepted"); got != 4 {
+		t.Errorf("sampled %d records, want 4", got)
+	}
+
+	// Other messages and warnings are counted separately or not sampled
+	logger.Info("duplicate")
+	for range 5 {
+		logger.Warn("invalid signature")
+	}
+	if got := strings.Count(buf.String(), "msg=duplicate"); got != 1 {
+		t.Errorf("sampled %d duplicate records, want 1", got)
+	}
+	if got := strings.Count(buf.String(), `msg="invalid signature"`); got != 5 {
+		t.Errorf("sampled %d warnings, want 5", got)
+	}
+
+	// A new interval starts over
+	now = now.Add(time.Second)
+	buf.Reset()
+	logger.Info("accepted")
+	if !strings.Contains(buf.String(), "client_id=1") {
+		t.Errorf("record after new interval = %q, want it logged with attributes", buf.String())
+	}
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("submissions_total", "Submissions received", "client", "result")
+	g := r.NewGauge("connected_clients", "Connected clients")
+
+	c.Inc("1", "accepted")
+	c.Inc("1", "accepted")
+	c.Add(3, "2", "duplicate")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	if got := c.Get("1", "accepted"); got != 2 {
+		t.Errorf("Counter.Get(1, accepted) = %v, want 2", got)
+	}
+	if got := c.Get("2", "accepted"); got != 0 {
+		t.Errorf("Counter.Get(2, accepted) = %v, want 0", got)
+	}
+	if got := g.Get(); got != 1 {
+		t.Errorf("Gauge.Get() = %v, want 1", got)
+	}
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatalf("WriteText() failed: %v", err)
+	}
+	want := `# HELP submissions_total Submissions received
+# TYPE submissions_total counter
+submissions_total{client="1",result="accepted"} 2
+submissions_total{client="2",result="duplicate"} 3
+# HELP connected_clients Connected clients
+# TYPE connected_clients gauge
+connected_clients 1
+`
+	if sb.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", sb.String(), want)
+	}
+
+	g.Delete()
+	if got := g.Get(); got != 0 {
+		t.Errorf("Gauge.Get() = %v, want 0 after Delete", got)
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "Requests", "code")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Inc() with missing label value did not panic")
+		}
+	}()
+	c.Inc()
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("latency_seconds", "Latency", []float64{0.5, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.3)
+	h.Observe(2)
+
+	count, sum := h.Count()
+	if count != 4 || sum != 2.45 {
+		t.Errorf("Count() = (%d, %v), want (4, 2.45)", count, sum)
+	}
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatalf("WriteText() failed: %v", err)
+	}
+	want := `# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="0.5"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 2.45
+latency_seconds_count 4
+`
+	if sb.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", sb.String(), want)
+	}
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	got := ExponentialBuckets(1, 2, 4)
+	want := []float64{1, 2, 4, 8}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ExponentialBuckets(1, 2, 4) = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("up", "Server is up").Set(1)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "up 1\n") {
+		t.Errorf("Handler() body = %q, want it to contain %q", rec.Body.String(), "up 1\n")
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Handler() Content-Type = %q, want text/plain", ct)
+	}
+}
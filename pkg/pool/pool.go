@@ -33,6 +33,39 @@ func (p *NumberPool) Add(num int32, clientID int32) bool {
     return true
 }
 
+// Deducts penalty points from the client's score, the score may become negative
+func (p *NumberPool) Deduct(clientID int32, points int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients[clientID] -= points
+}
+
+// Clears the pool and the scoreboard so that a new round can start
+func (p *NumberPool) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.numbers = make(map[int32]bool)
+	p.clients = make(map[int32]int)
+}
+
+// Returns the maximum number of primes the pool accepts
+func (p *NumberPool) Max() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.max
+}
+
+// Changes the maximum, fails if it is not above the current length so that the pool can still be filled
+func (p *NumberPool) SetMax(max int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if max <= len(p.numbers) {
+		return false
+	}
+	p.max = max
+	return true
+}
+
 func (p *NumberPool) Len() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
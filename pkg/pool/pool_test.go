@@ -92,4 +92,74 @@ func containsAll(got, expected []int32) bool {
         }
     }
     return true
-}
\ No newline at end of file
+}
+
+// TestReset tests that Reset clears numbers and scores but keeps the max
+func TestReset(t *testing.T) {
+	p := NewNumberPool(2)
+	p.Add(2, 1)
+	p.Add(3, 2)
+	if p.Add(5, 1) {
+		t.Fatalf("Add(5, 1) succeeded when pool full, expected false")
+	}
+
+	p.Reset()
+	if p.Len() != 0 {
+		t.Errorf("Len() = %d, want 0 after Reset", p.Len())
+	}
+	if got := p.GetScoreboard(); len(got) != 0 {
+		t.Errorf("GetScoreboard() = %v, want empty map after Reset", got)
+	}
+
+	// Numbers from the previous round are accepted again
+	if !p.Add(2, 2) {
+		t.Errorf("Add(2, 2) failed after Reset, expected true")
+	}
+	if !p.Add(5, 1) {
+		t.Errorf("Add(5, 1) failed after Reset, expected true")
+	}
+	if p.Add(7, 1) {
+		t.Errorf("Add(7, 1) succeeded when pool full after Reset, expected false")
+	}
+}
+
+// TestSetMax tests raising and lowering the max of a pool
+func TestSetMax(t *testing.T) {
+	p := NewNumberPool(2)
+	p.Add(2, 1)
+	p.Add(3, 1)
+
+	if p.SetMax(2) {
+		t.Errorf("SetMax(2) succeeded with 2 numbers in the pool, expected false")
+	}
+	if !p.SetMax(3) {
+		t.Fatalf("SetMax(3) failed, expected true")
+	}
+	if p.Max() != 3 {
+		t.Errorf("Max() = %d, want 3", p.Max())
+	}
+	if !p.Add(5, 2) {
+		t.Errorf("Add(5, 2) failed after raising max, expected true")
+	}
+	if p.Add(7, 2) {
+		t.Errorf("Add(7, 2) succeeded when pool full, expected false")
+	}
+}
+
+// TestDeduct tests that penalties lower the score but keep the numbers
+func TestDeduct(t *testing.T) {
+	p := NewNumberPool(5)
+	p.Add(2, 1)
+	p.Add(3, 1)
+	p.Add(5, 2)
+
+	p.Deduct(1, 1)
+	p.Deduct(2, 3)
+	expected := map[int32]int{1: 1, 2: -2}
+	if got := p.GetScoreboard(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetScoreboard() = %v, want %v after deductions", got, expected)
+	}
+	if p.Len() != 3 {
+		t.Errorf("Len() = %d, want 3 after deductions", p.Len())
+	}
+}
@@ -0,0 +1,201 @@
+package primes
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Pratt certificate that P is prime: a witness whose multiplicative order modulo P is P-1, with the prime
+// factorization of P-1 and certificates for its factors. It is checked with a few modular exponentiations,
+// cheaper than testing P again, and cannot be forged for a composite P.
+type Certificate struct {
+	P       uint32
+	Witness uint32   // Zero for 2, which needs no proof
+	Factors []Factor // Prime factors of P-1 in increasing order
+}
+
+// A prime power dividing P-1
+type Factor struct {
+	Exp  uint8
+	Cert *Certificate
+}
+
+// Limits on decoded certificates, a certificate of an int32 never comes close to them
+const (
+	maxCertificateDepth = 32
+	maxCertificateNodes = 256
+)
+
+var errCertificateTruncated = errors.New("certificate truncated")
+
+// Builds the Pratt certificate of n, fails if n is not prime
+func Certify(n int32) (*Certificate, error) {
+	if !IsPrime(n) {
+		return nil, fmt.Errorf("%d is not prime", n)
+	}
+	return certify(uint32(n)), nil
+}
+
+func certify(p uint32) *Certificate {
+	cert := &Certificate{P: p}
+	if p == 2 {
+		return cert
+	}
+	for _, f := range factorize(p - 1) {
+		cert.Factors = append(cert.Factors, Factor{Exp: f.exp, Cert: certify(f.prime)})
+	}
+	// The smallest primitive root is small, a few hundred at most for 32-bit primes
+	for a := uint32(2); ; a++ {
+		if cert.isPrimitiveRoot(a) {
+			cert.Witness = a
+			return cert
+		}
+	}
+}
+
+type primePower struct {
+	prime uint32
+	exp   uint8
+}
+
+// Prime factorization of n by trial division, n fits in 32 bits so divisors stop at 65536
+func factorize(n uint32) []primePower {
+	var factors []primePower
+	for d := uint32(2); uint64(d)*uint64(d) <= uint64(n); d++ {
+		if n%d != 0 {
+			continue
+		}
+		f := primePower{prime: d}
+		for n%d == 0 {
+			n /= d
+			f.exp++
+		}
+		factors = append(factors, f)
+	}
+	if n > 1 {
+		factors = append(factors, primePower{prime: n, exp: 1})
+	}
+	return factors
+}
+
+// Reports whether a^(P-1) = 1 and a^((P-1)/q) != 1 modulo P for every prime factor q of P-1
+func (c *Certificate) isPrimitiveRoot(a uint32) bool {
+	if powMod(a, c.P-1, c.P) != 1 {
+		return false
+	}
+	for _, f := range c.Factors {
+		if powMod(a, (c.P-1)/f.Cert.P, c.P) == 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func powMod(base, exp, mod uint32) uint32 {
+	result, b, m := uint64(1), uint64(base)%uint64(mod), uint64(mod)
+	for ; exp > 0; exp >>= 1 {
+		if exp&1 == 1 {
+			result = result * b % m
+		}
+		b = b * b % m
+	}
+	return uint32(result)
+}
+
+// Checks that the certificate proves n prime
+func (c *Certificate) Verify(n int32) error {
+	if n < 2 || c.P != uint32(n) {
+		return fmt.Errorf("certificate is for %d, not %d", c.P, n)
+	}
+	return c.verify()
+}
+
+func (c *Certificate) verify() error {
+	if c.P == 2 {
+		return nil
+	}
+	if c.P < 2 || len(c.Factors) == 0 {
+		return fmt.Errorf("certificate of %d has no factors", c.P)
+	}
+	// The factors must be the complete factorization of P-1, each proven prime in turn
+	product := uint64(1)
+	for i, f := range c.Factors {
+		if f.Cert == nil || f.Exp == 0 || (i > 0 && f.Cert.P <= c.Factors[i-1].Cert.P) {
+			return fmt.Errorf("certificate of %d has invalid factors", c.P)
+		}
+		for range f.Exp {
+			if product *= uint64(f.Cert.P); product > uint64(c.P-1) {
+				return fmt.Errorf("factors of the certificate of %d do not multiply to %d", c.P, c.P-1)
+			}
+		}
+		if err := f.Cert.verify(); err != nil {
+			return err
+		}
+	}
+	if product != uint64(c.P-1) {
+		return fmt.Errorf("factors of the certificate of %d do not multiply to %d", c.P, c.P-1)
+	}
+	if c.Witness < 2 || !c.isPrimitiveRoot(c.Witness) {
+		return fmt.Errorf("witness %d of the certificate of %d is not a primitive root", c.Witness, c.P)
+	}
+	return nil
+}
+
+// Encodes the certificate depth first: P and Witness as 4 bytes little endian, the number of factors,
+// then the exponent and certificate of each factor
+func (c *Certificate) MarshalBinary() ([]byte, error) {
+	return c.appendBinary(nil), nil
+}
+
+func (c *Certificate) appendBinary(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, c.P)
+	b = binary.LittleEndian.AppendUint32(b, c.Witness)
+	b = append(b, byte(len(c.Factors)))
+	for _, f := range c.Factors {
+		b = append(b, f.Exp)
+		b = f.Cert.appendBinary(b)
+	}
+	return b
+}
+
+// Decodes a certificate encoded by MarshalBinary. The result still has to be verified.
+func (c *Certificate) UnmarshalBinary(data []byte) error {
+	nodes := 0
+	rest, err := c.decode(data, 0, &nodes)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("%d trailing bytes after certificate", len(rest))
+	}
+	return nil
+}
+
+func (c *Certificate) decode(b []byte, depth int, nodes *int) ([]byte, error) {
+	if *nodes++; depth > maxCertificateDepth || *nodes > maxCertificateNodes {
+		return nil, errors.New("certificate too large")
+	}
+	if len(b) < 9 {
+		return nil, errCertificateTruncated
+	}
+	c.P = binary.LittleEndian.Uint32(b)
+	c.Witness = binary.LittleEndian.Uint32(b[4:])
+	count := int(b[8])
+	b = b[9:]
+	c.Factors = nil
+	if count > 0 {
+		c.Factors = make([]Factor, count)
+	}
+	for i := range c.Factors {
+		if len(b) < 1 {
+			return nil, errCertificateTruncated
+		}
+		c.Factors[i] = Factor{Exp: b[0], Cert: &Certificate{}}
+		var err error
+		if b, err = c.Factors[i].Cert.decode(b[1:], depth+1, nodes); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,92 @@
+package primes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCertifyAndVerify(t *testing.T) {
+	for _, n := range []int32{2, 3, 97, 65537, 1000003, 1073741789, 2147483647} {
+		cert, err := Certify(n)
+		if err != nil {
+			t.Fatalf("Certify(%d) failed: %v", n, err)
+		}
+		if err := cert.Verify(n); err != nil {
+			t.Errorf("Certify(%d).Verify() failed: %v", n, err)
+		}
+		if err := cert.Verify(n + 2); err == nil {
+			t.Errorf("Certify(%d).Verify(%d) succeeded, want an error", n, n+2)
+		}
+	}
+	for _, n := range []int32{-7, 0, 1, 91, 2147483646} {
+		if _, err := Certify(n); err == nil {
+			t.Errorf("Certify(%d) succeeded, want an error", n)
+		}
+	}
+}
+
+func TestVerifyRejectsForgeries(t *testing.T) {
+	tests := []struct {
+		name   string
+		forge  func(c *Certificate)
+		number int32
+	}{
+		{"composite", func(c *Certificate) { c.P = 91 }, 91},
+		{"witness", func(c *Certificate) { c.Witness = 1 }, 97},
+		{"non primitive witness", func(c *Certificate) { c.Witness = 2 }, 97}, // 2 has order 48 modulo 97
+		{"missing factor", func(c *Certificate) { c.Factors = c.Factors[:1] }, 97},
+		{"repeated factor", func(c *Certificate) { c.Factors[1] = c.Factors[0] }, 97},
+		{"bad sub certificate", func(c *Certificate) { c.Factors[1].Cert.Witness = 1 }, 97},
+	}
+	for _, tt := range tests {
+		cert, _ := Certify(97)
+		tt.forge(cert)
+		if err := cert.Verify(tt.number); err == nil {
+			t.Errorf("%s: Verify(%d) succeeded, want an error", tt.name, tt.number)
+		}
+	}
+}
+
+func TestCertificateBinary(t *testing.T) {
+	cert, _ := Certify(2147483647)
+	data, err := cert.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	var got Certificate
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() failed: %v", err)
+	}
+	if !reflect.DeepEqual(&got, cert) {
+		t.Errorf("UnmarshalBinary() = %+v, want %+v", got, cert)
+	}
+
+	for _, bad := range [][]byte{nil, data[:len(data)-1], append(data, 0)} {
+		if err := new(Certificate).UnmarshalBinary(bad); err == nil {
+			t.Errorf("UnmarshalBinary(%d bytes) succeeded, want an error", len(bad))
+		}
+	}
+	// A chain of certificates each claiming one factor nests deeper than any real certificate
+	var deep []byte
+	for range maxCertificateDepth + 2 {
+		deep = append(deep, 3, 0, 0, 0, 2, 0, 0, 0, 1, 1)
+	}
+	if err := new(Certificate).UnmarshalBinary(deep); err == nil {
+		t.Error("UnmarshalBinary(deeply nested certificate) succeeded, want an error")
+	}
+}
+
+func TestValidCertified(t *testing.T) {
+	twin, _ := ParseValidator("twin")
+	cert, _ := Certify(101)
+	if !ValidCertified(twin, 101, cert) {
+		t.Error("ValidCertified(twin, 101) = false, want true")
+	}
+	cert, _ = Certify(97)
+	if ValidCertified(twin, 97, cert) {
+		t.Error("ValidCertified(twin, 97) = true, want false")
+	}
+	if ValidCertified(twin, 101, cert) {
+		t.Error("ValidCertified(twin, 101) with the certificate of 97 = true, want false")
+	}
+}
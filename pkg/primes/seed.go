@@ -0,0 +1,33 @@
+package primes
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	mathrand "math/rand"
+)
+
+// Seed of the random generators of a run. Replaying a run with the same seed and the same number of
+// streams draws the same numbers, whatever client IDs the server assigns.
+type Seed uint64
+
+// Draws a seed from crypto/rand, for runs that should not repeat each other
+func NewSeed() (Seed, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return Seed(binary.LittleEndian.Uint64(b[:])), nil
+}
+
+// Creates the random generator of the stream, e.g. a worker index. Streams of a seed are independent.
+func (s Seed) Rand(stream int) *mathrand.Rand {
+	return mathrand.New(mathrand.NewSource(int64(splitMix(uint64(s) ^ splitMix(uint64(stream))))))
+}
+
+// SplitMix64 finalizer, spreads close inputs such as consecutive streams over unrelated seeds
+func splitMix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
@@ -0,0 +1,28 @@
+package primes
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSeedReproducible(t *testing.T) {
+	seed := Seed(42)
+	first := drain(NewRandom(1000, seed.Rand(3)), 20)
+	if again := drain(NewRandom(1000, seed.Rand(3)), 20); !slices.Equal(first, again) {
+		t.Errorf("Same seed and stream drew %v then %v, want the same primes", first, again)
+	}
+	if other := drain(NewRandom(1<<30, seed.Rand(4)), 20); slices.Equal(drain(NewRandom(1<<30, seed.Rand(3)), 20), other) {
+		t.Error("Streams 3 and 4 drew the same primes, want independent streams")
+	}
+}
+
+func TestNewSeed(t *testing.T) {
+	a, err := NewSeed()
+	if err != nil {
+		t.Fatalf("NewSeed() failed: %v", err)
+	}
+	b, _ := NewSeed()
+	if a == b {
+		t.Errorf("NewSeed() returned %d twice", a)
+	}
+}
@@ -0,0 +1,90 @@
+package primes
+
+import (
+	"iter"
+	"sync"
+)
+
+// Numbers sieved at a time, bounding the memory of a Sieve whatever its range
+const SieveSegment = 1 << 16
+
+// Primes up to the square root of primes.MaxRange, enough to sieve any range of int32
+var basePrimes = sync.OnceValue(func() []int64 {
+	const limit = 46341 // Smallest number whose square exceeds math.MaxInt32
+	composite := make([]bool, limit+1)
+	var found []int64
+	for n := int64(2); n <= limit; n++ {
+		if composite[n] {
+			continue
+		}
+		found = append(found, n)
+		for m := n * n; m <= limit; m += n {
+			composite[m] = true
+		}
+	}
+	return found
+})
+
+// Yields every prime in [lo, hi) in increasing order with a segmented Sieve of Eratosthenes.
+// It sieves SieveSegment numbers at a time, so memory stays bounded whatever the size of the range.
+type Sieve struct {
+	next, hi  int64  // Start of the next segment and end of the range
+	segment   []bool // Composite flags of the current segment
+	segmentLo int64
+	segmentN  int // Numbers in the current segment
+	pos       int // Next index of the segment to look at
+}
+
+func NewSieve(lo, hi int64) *Sieve {
+	lo, hi = max(lo, 2), min(hi, MaxRange)
+	return &Sieve{next: lo, hi: hi, segment: make([]bool, min(SieveSegment, max(hi-lo, 0)))}
+}
+
+func (s *Sieve) Next() (int32, bool) {
+	for {
+		for s.pos < s.segmentN {
+			i := s.pos
+			s.pos++
+			if !s.segment[i] {
+				return int32(s.segmentLo + int64(i)), true
+			}
+		}
+		if s.next >= s.hi {
+			return 0, false
+		}
+		s.sieve()
+	}
+}
+
+// Flags the composites of the next segment
+func (s *Sieve) sieve() {
+	lo := s.next
+	hi := min(lo+int64(len(s.segment)), s.hi)
+	n := int(hi - lo)
+	clear(s.segment[:n])
+	for _, p := range basePrimes() {
+		if p*p >= hi {
+			break
+		}
+		// Smaller multiples of p also have a smaller prime factor and are flagged by it
+		start := max(p*p, (lo+p-1)/p*p)
+		for m := start; m < hi; m += p {
+			s.segment[m-lo] = true
+		}
+	}
+	s.segmentLo, s.segmentN, s.pos = lo, n, 0
+	s.next = hi
+}
+
+// Iterates over the primes in [lo, hi) in increasing order, see Sieve
+func Range(lo, hi int64) iter.Seq[int32] {
+	return func(yield func(int32) bool) {
+		s := NewSieve(lo, hi)
+		for {
+			n, ok := s.Next()
+			if !ok || !yield(n) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package primes
+
+import (
+	"slices"
+	"testing"
+)
+
+// Primes of [lo, hi) by trial division
+func trialDivision(lo, hi int64) []int32 {
+	var want []int32
+	for n := lo; n < hi; n++ {
+		if IsPrime(int32(n)) {
+			want = append(want, int32(n))
+		}
+	}
+	return want
+}
+
+func TestSieve(t *testing.T) {
+	tests := []struct {
+		name   string
+		lo, hi int64
+	}{
+		{"small", 0, 30},
+		{"empty", 20, 20},
+		{"reversed", 30, 20},
+		{"no primes", 24, 29},
+		{"across segments", SieveSegment - 100, 2*SieveSegment + 100},
+		{"large numbers", 1_000_000_000, 1_000_100_000},
+		{"up to MaxRange", MaxRange - 1000, MaxRange},
+	}
+	for _, tt := range tests {
+		got := drain(NewSieve(tt.lo, tt.hi), 1<<20)
+		if want := trialDivision(max(tt.lo, 0), tt.hi); !slices.Equal(got, want) {
+			t.Errorf("%s: Sieve(%d, %d) yielded %d primes, want %d", tt.name, tt.lo, tt.hi, len(got), len(want))
+		}
+	}
+}
+
+func TestSieveExhausted(t *testing.T) {
+	s := NewSieve(0, 10)
+	drain(s, 100)
+	if n, ok := s.Next(); ok {
+		t.Errorf("Next() after the last prime = %d, want false", n)
+	}
+}
+
+func TestRange(t *testing.T) {
+	var got []int32
+	for n := range Range(10, 1000) {
+		if n > 30 {
+			break
+		}
+		got = append(got, n)
+	}
+	if want := []int32{11, 13, 17, 19, 23, 29}; !slices.Equal(got, want) {
+		t.Errorf("Range(10, 1000) up to 30 = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package primes
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Upper bound, exclusive, of the ranges covering every positive int32
+const MaxRange = math.MaxInt32 + 1
+
+// Numbers per block of a Stride, large enough for every block to hold primes
+const StrideBlock = 1 << 12
+
+// Decides which primes a client submits.
+// Implementations are not safe for concurrent use, give every worker its own.
+type Strategy interface {
+	// Returns the next prime to submit, false once the strategy has none left
+	Next() (int32, bool)
+}
+
+// Strategy names as used on the command line
+const (
+	StrategyRandom     = "random"     // Uniform random primes, see Random
+	StrategySequential = "sequential" // Every prime of a configured range, see Sieve
+	StrategyAssigned   = "assigned"   // Every prime of a range assigned by the server, see Sieve
+	StrategyStride     = "stride"     // Blocks of a range interleaved by client ID, see Stride
+	StrategyLeased     = "leased"     // Every prime of the work units leased from the server one after the other
+)
+
+// Validates a strategy name, empty means random
+func ParseStrategy(name string) (string, error) {
+	switch name {
+	case "":
+		return StrategyRandom, nil
+	case StrategyRandom, StrategySequential, StrategyAssigned, StrategyStride, StrategyLeased:
+		return name, nil
+	default:
+		return "", fmt.Errorf("unknown strategy %q, want random, sequential, assigned, stride or leased", name)
+	}
+}
+
+// Draws uniform random primes in [2, max], it never runs out.
+// Clients drawing from the same range collide more and more often as the pool fills.
+type Random struct {
+	max int32
+	rng *rand.Rand
+}
+
+func NewRandom(max int32, rng *rand.Rand) *Random {
+	return &Random{max: max, rng: rng}
+}
+
+func (s *Random) Next() (int32, bool) {
+	return GenerateRandomPrime(s.max, s.rng), true
+}
+
+// Splits [lo, hi) into blocks of StrideBlock numbers and yields the primes of every count-th block,
+// starting with block index. Strides with the same count and different indexes never yield the same prime.
+type Stride struct {
+	lo, hi       int64
+	index, count int64
+	block        *Sieve
+}
+
+// Creates the stride of the index, taken modulo count so that it can be a client ID
+func NewStride(lo, hi int64, index, count int) *Stride {
+	count = max(count, 1)
+	return &Stride{lo: max(lo, 2), hi: min(hi, MaxRange), index: int64(index % count), count: int64(count), block: &Sieve{}}
+}
+
+func (s *Stride) Next() (int32, bool) {
+	for {
+		if n, ok := s.block.Next(); ok {
+			return n, true
+		}
+		start := s.lo + s.index*StrideBlock
+		if start >= s.hi {
+			return 0, false
+		}
+		s.block = NewSieve(start, min(start+StrideBlock, s.hi))
+		s.index += s.count
+	}
+}
+
+// Returns the i-th of n contiguous parts of [lo, hi), to spread a range over workers
+func Split(lo, hi int64, i, n int) (int64, int64) {
+	size := hi - lo
+	return lo + size*int64(i)/int64(n), lo + size*int64(i+1)/int64(n)
+}
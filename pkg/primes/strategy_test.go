@@ -0,0 +1,69 @@
+package primes
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Collects what the strategy yields until it runs out or limit primes were drawn
+func drain(s Strategy, limit int) []int32 {
+	var got []int32
+	for len(got) < limit {
+		n, ok := s.Next()
+		if !ok {
+			break
+		}
+		got = append(got, n)
+	}
+	return got
+}
+
+func TestParseStrategy(t *testing.T) {
+	for name, want := range map[string]string{"": StrategyRandom, "stride": StrategyStride, "assigned": StrategyAssigned} {
+		if got, err := ParseStrategy(name); err != nil || got != want {
+			t.Errorf("ParseStrategy(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseStrategy("sieve"); err == nil {
+		t.Error("ParseStrategy(\"sieve\") succeeded, want an error")
+	}
+}
+
+func TestRandom(t *testing.T) {
+	for _, n := range drain(NewRandom(100, rand.New(rand.NewSource(1))), 20) {
+		if n > 100 || !IsPrime(n) {
+			t.Errorf("Random yielded %d, want a prime up to 100", n)
+		}
+	}
+}
+
+func TestStrideDisjoint(t *testing.T) {
+	const count = 3
+	hi := int64(10 * StrideBlock)
+	seen := make(map[int32]int)
+	for index := range count {
+		for _, n := range drain(NewStride(0, hi, index, count), 1<<20) {
+			if prev, ok := seen[n]; ok {
+				t.Fatalf("Strides %d and %d both yielded %d", prev, index, n)
+			}
+			seen[n] = index
+		}
+	}
+	if want := len(drain(NewSieve(0, hi), 1<<20)); len(seen) != want {
+		t.Errorf("Strides together yielded %d primes, want the %d primes of the range", len(seen), want)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	prev := int64(10)
+	for i := range 3 {
+		lo, hi := Split(10, 110, i, 3)
+		if lo != prev || hi <= lo {
+			t.Errorf("Split(10, 110, %d, 3) = [%d, %d), want to start at %d", i, lo, hi, prev)
+		}
+		prev = hi
+	}
+	if prev != 110 {
+		t.Errorf("Split parts end at %d, want 110", prev)
+	}
+}
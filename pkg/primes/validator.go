@@ -0,0 +1,198 @@
+package primes
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// A property every number of a room must have, known to clients by the rule name it prints as
+type Validator interface {
+	Valid(n int32) bool
+	String() string // Rule as accepted by ParseValidator
+}
+
+// Parses a rule: any, prime, twin, sophie-germain, palindromic or range:LO-HI for the primes of [LO, HI)
+func ParseValidator(rule string) (Validator, error) {
+	switch rule {
+	case "any":
+		return anyNumber{}, nil
+	case "prime":
+		return prime{}, nil
+	case "twin":
+		return twinPrime{}, nil
+	case "sophie-germain":
+		return sophieGermainPrime{}, nil
+	case "palindromic":
+		return palindromicPrime{}, nil
+	}
+	if bounds, ok := strings.CutPrefix(rule, "range:"); ok {
+		lo, hi, ok := strings.Cut(bounds, "-")
+		l, errLo := strconv.ParseInt(lo, 10, 64)
+		h, errHi := strconv.ParseInt(hi, 10, 64)
+		if !ok || errLo != nil || errHi != nil || l >= h || l < 0 || h > MaxRange {
+			return nil, fmt.Errorf("invalid range rule %q, want range:LO-HI with 0 <= LO < HI <= %d", rule, int64(MaxRange))
+		}
+		return primeRange{lo: l, hi: h}, nil
+	}
+	return nil, fmt.Errorf("unknown rule %q, want any, prime, twin, sophie-germain, palindromic or range:LO-HI", rule)
+}
+
+// Accepts any number, primes included
+type anyNumber struct{}
+
+func (anyNumber) Valid(int32) bool { return true }
+func (anyNumber) String() string   { return "any" }
+
+type prime struct{}
+
+func (prime) Valid(n int32) bool       { return IsPrime(n) }
+func (prime) holdsForPrime(int32) bool { return true }
+func (prime) String() string           { return "prime" }
+
+// Primes p such that p-2 or p+2 is prime
+type twinPrime struct{}
+
+func (t twinPrime) Valid(n int32) bool { return IsPrime(n) && t.holdsForPrime(n) }
+func (twinPrime) holdsForPrime(n int32) bool {
+	return isPrime64(int64(n)-2) || isPrime64(int64(n)+2)
+}
+func (twinPrime) String() string { return "twin" }
+
+// Primes p such that 2p+1 is prime
+type sophieGermainPrime struct{}
+
+func (s sophieGermainPrime) Valid(n int32) bool       { return IsPrime(n) && s.holdsForPrime(n) }
+func (sophieGermainPrime) holdsForPrime(n int32) bool { return isPrime64(2*int64(n) + 1) }
+func (sophieGermainPrime) String() string             { return "sophie-germain" }
+
+// Primes that read the same backwards in base 10
+type palindromicPrime struct{}
+
+func (p palindromicPrime) Valid(n int32) bool       { return p.holdsForPrime(n) && IsPrime(n) }
+func (palindromicPrime) holdsForPrime(n int32) bool { return n >= 0 && int64(n) == reverse(int64(n)) }
+func (palindromicPrime) String() string             { return "palindromic" }
+
+// Primes of [lo, hi)
+type primeRange struct {
+	lo, hi int64
+}
+
+func (r primeRange) Valid(n int32) bool { return r.holdsForPrime(n) && IsPrime(n) }
+func (r primeRange) holdsForPrime(n int32) bool {
+	return int64(n) >= r.lo && int64(n) < r.hi
+}
+func (r primeRange) String() string { return fmt.Sprintf("range:%d-%d", r.lo, r.hi) }
+
+// Implemented by the validators of rules that only accept primes, to check the rest of the rule for
+// a number already proven prime
+type primeProperty interface {
+	holdsForPrime(n int32) bool
+}
+
+// Reports whether n is valid for v given a primality certificate of n. The certificate replaces the
+// primality test of the rules that only accept primes, a certificate that does not prove n prime fails.
+func ValidCertified(v Validator, n int32, cert *Certificate) bool {
+	if cert.Verify(n) != nil {
+		return false
+	}
+	if p, ok := v.(primeProperty); ok {
+		return p.holdsForPrime(n)
+	}
+	return v.Valid(n)
+}
+
+// Trial division for numbers that may not fit in an int32, such as 2p+1
+func isPrime64(n int64) bool {
+	if n < 2 {
+		return false
+	}
+	for i := int64(2); i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal digits of n in reverse order
+func reverse(n int64) int64 {
+	var r int64
+	for ; n > 0; n /= 10 {
+		r = r*10 + n%10
+	}
+	return r
+}
+
+// Wraps the strategy so that it only yields numbers valid for v
+func Matching(s Strategy, v Validator) Strategy {
+	if _, ok := v.(anyNumber); ok {
+		return s // Primes are valid numbers too
+	}
+	return &matching{s: s, v: v}
+}
+
+type matching struct {
+	s Strategy
+	v Validator
+}
+
+func (m *matching) Next() (int32, bool) {
+	for {
+		n, ok := m.s.Next()
+		if !ok || m.v.Valid(n) {
+			return n, ok
+		}
+	}
+}
+
+// Limits [lo, hi) to the numbers the validator can accept, to search ranges matching the rule
+func Bounds(v Validator, lo, hi int64) (int64, int64) {
+	if r, ok := v.(primeRange); ok {
+		return max(lo, r.lo), min(hi, r.hi)
+	}
+	return lo, hi
+}
+
+// Draws random numbers valid for v, faster than filtering random primes for the rules that accept few of them
+func RandomFor(v Validator, rng *rand.Rand) Strategy {
+	switch v := v.(type) {
+	case palindromicPrime:
+		return &randomPalindromes{rng: rng}
+	case primeRange:
+		return Matching(&randomRange{lo: v.lo, hi: v.hi, rng: rng}, v)
+	default:
+		return Matching(NewRandom(math.MaxInt32, rng), v)
+	}
+}
+
+// Uniform random numbers of [lo, hi), the caller filters out those that are not valid
+type randomRange struct {
+	lo, hi int64
+	rng    *rand.Rand
+}
+
+func (s *randomRange) Next() (int32, bool) {
+	return int32(s.lo + s.rng.Int63n(s.hi-s.lo)), true
+}
+
+// Random palindromic primes built by mirroring a random first half. Palindromes with an even number
+// of digits are multiples of 11, so only odd lengths up to 9 digits are drawn.
+type randomPalindromes struct {
+	rng *rand.Rand
+}
+
+func (s *randomPalindromes) Next() (int32, bool) {
+	for {
+		half := 1 + s.rng.Int63n(99999) // Halves of k digits give palindromes of 2k-1 digits
+		n := half
+		for rest := half / 10; rest > 0; rest /= 10 {
+			n = n*10 + rest%10
+		}
+		if IsPrime(int32(n)) {
+			return int32(n), true
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package primes
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestParseValidator(t *testing.T) {
+	for _, rule := range []string{"any", "prime", "twin", "sophie-germain", "palindromic", "range:100-200"} {
+		v, err := ParseValidator(rule)
+		if err != nil {
+			t.Errorf("ParseValidator(%q) failed: %v", rule, err)
+			continue
+		}
+		if v.String() != rule {
+			t.Errorf("ParseValidator(%q).String() = %q, want the rule back", rule, v.String())
+		}
+	}
+	for _, rule := range []string{"", "mersenne", "range:200-100", "range:1", "range:a-b", "range:0-3000000000"} {
+		if _, err := ParseValidator(rule); err == nil {
+			t.Errorf("ParseValidator(%q) succeeded, want an error", rule)
+		}
+	}
+}
+
+func TestValidators(t *testing.T) {
+	tests := []struct {
+		rule    string
+		valid   []int32
+		invalid []int32
+	}{
+		{"any", []int32{0, 4, 2147483647}, nil},
+		{"prime", []int32{2, 97, 2147483647}, []int32{1, 4, 91}},
+		{"twin", []int32{3, 5, 7, 11, 13, 101, 103}, []int32{2, 23, 97, 4}},
+		{"sophie-germain", []int32{2, 3, 5, 11, 23, 29, 1073741789}, []int32{7, 13, 17, 9}},
+		{"palindromic", []int32{2, 11, 101, 131, 929, 1003001}, []int32{13, 121, 1001, 22}},
+		{"range:100-200", []int32{101, 199}, []int32{97, 200, 211, 150}},
+	}
+	for _, tt := range tests {
+		v, err := ParseValidator(tt.rule)
+		if err != nil {
+			t.Fatalf("ParseValidator(%q) failed: %v", tt.rule, err)
+		}
+		for _, n := range tt.valid {
+			if !v.Valid(n) {
+				t.Errorf("%s: Valid(%d) = false, want true", tt.rule, n)
+			}
+		}
+		for _, n := range tt.invalid {
+			if v.Valid(n) {
+				t.Errorf("%s: Valid(%d) = true, want false", tt.rule, n)
+			}
+		}
+	}
+}
+
+func TestGeneratorsMatchValidators(t *testing.T) {
+	for _, rule := range []string{"prime", "twin", "sophie-germain", "palindromic", "range:1000-1100"} {
+		v, _ := ParseValidator(rule)
+		for _, n := range drain(RandomFor(v, rand.New(rand.NewSource(1))), 50) {
+			if !v.Valid(n) {
+				t.Errorf("RandomFor(%s) drew %d, which is not valid", rule, n)
+			}
+		}
+		lo, hi := Bounds(v, 0, 1<<20)
+		for _, n := range drain(Matching(NewSieve(lo, hi), v), 50) {
+			if !v.Valid(n) {
+				t.Errorf("Matching(Sieve, %s) yielded %d, which is not valid", rule, n)
+			}
+		}
+	}
+}
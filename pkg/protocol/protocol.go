@@ -0,0 +1,375 @@
+// Package protocol defines the wire format spoken between the server and its clients.
+//
+// Every message is a frame made of a 1-byte type, a 4-byte little-endian payload length and the payload.
+// Hot path frames (submissions and responses) use a fixed binary layout, handshake and control frames carry JSON.
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Type of a frame
+type FrameType uint8
+
+const (
+	FrameHello           FrameType = iota + 1 // Client -> server: join a room with a public key
+	FrameWelcome                              // Server -> client: assigned client ID and room settings
+	FrameError                                // Server -> client: connection rejected or closed, with the reason
+	FrameSubmit                               // Client -> server: signed number
+	FrameResponse                             // Server -> client: status code for a submission
+	FramePing                                 // Client -> server: heartbeat, keeps an idle connection alive
+	FramePong                                 // Server -> client: answer to a ping
+	FrameAnnouncement                         // Server -> client: unsolicited notice such as round results, may arrive before any response
+	FrameSubscribe                            // Client -> server: opt in or out of periodic updates, no reply
+	FrameLeaderboard                          // Server -> client: standings of the room, sent periodically to subscribers
+	FrameLeaseRequest                         // Client -> server: ask for a work unit, no payload
+	FrameLease                                // Server -> client: the work unit leased to the client
+	FrameComplete                             // Client -> server: a work unit was searched
+	FrameCompleteAck                          // Server -> client: whether the completion was recorded
+	FrameSubmitCertified                      // Client -> server: signed number with a primality certificate, answered like FrameSubmit
+	FrameSubmitBatch                          // Client -> server: several signed numbers, verified together
+	FrameBatchResponse                        // Server -> client: status codes for a batch, in submission order
+	FrameRotateKey                            // Client -> server: replace the client's key for the rest of the session
+	FrameRotateKeyAck                         // Server -> client: whether the key was replaced
+)
+
+// Largest payload accepted by ReadFrame
+const MaxPayload = 64 * 1024
+
+// Most submissions in a batch, enough for RSA signatures to fit in a frame
+const MaxBatch = 128
+
+// Response status codes
+const (
+	StatusDuplicate        int32 = 0  // Number is already in the pool
+	StatusAdded            int32 = 1  // Number added to the pool
+	StatusDone             int32 = -1 // Number added and completed the collection, server is done with the room
+	StatusShutdown         int32 = -2 // Another client completed the collection, server is done with the room
+	StatusInvalidSignature int32 = -3 // Signature does not match the number
+	StatusRoundComplete    int32 = -4 // Number added and completed the round, next round starts
+	StatusNewRound         int32 = -5 // A new round started since the last submission, number not counted
+	StatusInvalidNumber    int32 = -6 // Number does not satisfy the room's validation rule
+	StatusPaused           int32 = -7 // Room is paused, number not counted
+	StatusSlowDown         int32 = -8 // Client exceeded its rate limit, number not counted and should be resent later
+)
+
+var ErrPayloadTooLarge = errors.New("frame payload too large")
+
+// Sent by the client to join a room
+type Hello struct {
+	Room      string `json:"room"`
+	PublicKey []byte `json:"public_key"` // PEM encoded
+
+	// Token from a previous welcome to resume that session after a reconnect, the key must be the same
+	ResumeToken string `json:"resume_token,omitempty"`
+	// Asks the server for a range of numbers no other client of the room is assigned, see Welcome.Range
+	WantRange bool `json:"want_range,omitempty"`
+}
+
+// Half-open range of numbers [Lo, Hi)
+type Range struct {
+	Lo int64 `json:"lo"`
+	Hi int64 `json:"hi"`
+}
+
+// Sent by the server once the client joined a room
+type Welcome struct {
+	ClientID int32  `json:"client_id"`
+	Room     string `json:"room"`
+	Max      int    `json:"max"`
+	Rule     string `json:"rule"`
+	Rounds   int    `json:"rounds"`
+
+	// Milliseconds the server waits for a frame before evicting the client, zero if it never does.
+	// Clients with nothing to submit must ping more often than this.
+	IdleTimeout int64 `json:"idle_timeout_ms,omitempty"`
+
+	// Token to resume the session after a reconnect, empty if the server does not support resuming
+	ResumeToken string `json:"resume_token,omitempty"`
+	// Set when the hello's resume token was accepted, the client ID and scores carry over
+	Resumed bool `json:"resumed,omitempty"`
+	// Submissions of the session the server processed and the status of the last one, so that
+	// a resumed client knows whether the submission in flight when the connection dropped counted
+	Acked      uint64 `json:"acked,omitempty"`
+	LastStatus int32  `json:"last_status,omitempty"`
+	// Keys the session rotated so far, signed in the next rotation, see RotateKey
+	Rotations uint64 `json:"rotations,omitempty"`
+
+	// Range of the work unit leased to the client if it asked for one, nil if the server has none left.
+	// It is disjoint from the ranges of the other clients of the room, see Lease. UnitID identifies the
+	// unit so that the client can send Complete once it searched the range.
+	Range  *Range `json:"range,omitempty"`
+	UnitID int64  `json:"unit_id,omitempty"`
+}
+
+// A work unit leased to a client. A client holds at most one unit, asking again before completing it returns
+// the same unit. The server hands the unit to another client once its holder sent no frame for TTL.
+type Lease struct {
+	UnitID int64 `json:"unit_id"` // Zero when the server has no unit left
+	Range  Range `json:"range"`
+	TTL    int64 `json:"ttl_ms"`
+}
+
+// Reports a leased work unit as searched
+type Complete struct {
+	UnitID int64 `json:"unit_id"`
+	Found  int   `json:"found"` // Primes the client found in the unit's range
+}
+
+// Answer to a completion, rejected completions carry the reason
+type CompleteAck struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Replaces the key of the client, which keeps its client ID, scores and session. Signature is made with
+// the current key and NewSignature with the new one, both over auth.RotationMessage of the client ID,
+// the session's rotation count and PublicKey, proving that the client holds both keys.
+type RotateKey struct {
+	PublicKey    []byte `json:"public_key"` // New key, PEM encoded
+	Signature    []byte `json:"signature"`
+	NewSignature []byte `json:"new_signature"`
+}
+
+// Answer to a key rotation, the current key stays in use when it is rejected
+type RotateKeyAck struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Kinds of announcements
+const (
+	AnnounceRoundResult = "round_result" // A round finished, Round and Scoreboard are set
+	AnnounceMessage     = "message"      // Free text from the operator
+)
+
+// Sent by the server to the clients of a room outside of any request
+type Announcement struct {
+	Kind       string        `json:"kind"`
+	Room       string        `json:"room,omitempty"`
+	Message    string        `json:"message,omitempty"`
+	Round      int           `json:"round,omitempty"`
+	Scoreboard map[int32]int `json:"scoreboard,omitempty"` // Client ID -> numbers accepted in the round
+}
+
+// Sent by the client to choose the periodic updates it receives
+type Subscribe struct {
+	Leaderboard bool `json:"leaderboard"`
+}
+
+// Standings of a room sent to subscribed clients
+type Leaderboard struct {
+	Room       string             `json:"room"`
+	Round      int                `json:"round"`
+	PoolLength int                `json:"pool_length"`
+	Max        int                `json:"max"`
+	Clients    int                `json:"clients"` // Clients ranked, including the ones not in Top
+	Top        []LeaderboardEntry `json:"top"`
+	You        *LeaderboardEntry  `json:"you,omitempty"` // Nil until the client submitted a number
+}
+
+// A client's position on the leaderboard, counts are cumulative over rounds
+type LeaderboardEntry struct {
+	ClientID  int32 `json:"client_id"`
+	Rank      int   `json:"rank"`
+	Score     int   `json:"score"` // Accepted numbers minus penalties
+	Accepted  int   `json:"accepted"`
+	Duplicate int   `json:"duplicate"`
+	Invalid   int   `json:"invalid"` // Invalid signatures and numbers
+}
+
+// Sent by the server when it rejects a handshake or closes the connection with a reason
+type Error struct {
+	Message string `json:"message"`
+}
+
+// Writes a single frame with one call to w
+func WriteFrame(w io.Writer, t FrameType, payload []byte) error {
+	if len(payload) > MaxPayload {
+		return ErrPayloadTooLarge
+	}
+	buf := make([]byte, 5+len(payload))
+	buf[0] = byte(t)
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(payload)))
+	copy(buf[5:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// Reads a single frame from r
+func ReadFrame(r io.Reader) (FrameType, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.LittleEndian.Uint32(header[1:5])
+	if n > MaxPayload {
+		return 0, nil, ErrPayloadTooLarge
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return FrameType(header[0]), payload, nil
+}
+
+// Reads a single frame and fails if it is not of the expected type
+func ReadFrameOf(r io.Reader, want FrameType) ([]byte, error) {
+	t, payload, err := ReadFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	if t != want {
+		return nil, fmt.Errorf("unexpected frame type %d, want %d", t, want)
+	}
+	return payload, nil
+}
+
+// Writes a frame with v encoded as JSON
+func WriteJSON(w io.Writer, t FrameType, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return WriteFrame(w, t, payload)
+}
+
+// Decodes a JSON frame payload into v
+func DecodeJSON(payload []byte, v any) error {
+	return json.Unmarshal(payload, v)
+}
+
+// Writes a submission frame: the number followed by its signature
+func WriteSubmit(w io.Writer, num int32, signature []byte) error {
+	payload := make([]byte, 4+len(signature))
+	binary.LittleEndian.PutUint32(payload[:4], uint32(num))
+	copy(payload[4:], signature)
+	return WriteFrame(w, FrameSubmit, payload)
+}
+
+// Decodes a submission frame payload
+func DecodeSubmit(payload []byte) (int32, []byte, error) {
+	if len(payload) < 4 {
+		return 0, nil, errors.New("submission payload too short")
+	}
+	return int32(binary.LittleEndian.Uint32(payload[:4])), payload[4:], nil
+}
+
+// Writes a certified submission frame: the number, the length of its signature as 2 bytes little endian,
+// the signature and the encoded primality certificate, see primes.Certificate
+func WriteSubmitCertified(w io.Writer, num int32, signature, certificate []byte) error {
+	if len(signature) > math.MaxUint16 {
+		return errors.New("signature too long")
+	}
+	payload := make([]byte, 6+len(signature)+len(certificate))
+	binary.LittleEndian.PutUint32(payload[:4], uint32(num))
+	binary.LittleEndian.PutUint16(payload[4:6], uint16(len(signature)))
+	copy(payload[6:], signature)
+	copy(payload[6+len(signature):], certificate)
+	return WriteFrame(w, FrameSubmitCertified, payload)
+}
+
+// Decodes a certified submission frame payload into the number, its signature and its certificate
+func DecodeSubmitCertified(payload []byte) (int32, []byte, []byte, error) {
+	if len(payload) < 6 {
+		return 0, nil, nil, errors.New("certified submission payload too short")
+	}
+	n := 6 + int(binary.LittleEndian.Uint16(payload[4:6]))
+	if len(payload) < n {
+		return 0, nil, nil, errors.New("certified submission signature truncated")
+	}
+	return int32(binary.LittleEndian.Uint32(payload[:4])), payload[6:n], payload[n:], nil
+}
+
+// A signed number of a batch
+type Submission struct {
+	Num       int32
+	Signature []byte
+}
+
+// Writes a batch frame: the number of submissions as 2 bytes little endian, then each number followed by
+// the length of its signature as 2 bytes little endian and the signature
+func WriteSubmitBatch(w io.Writer, batch []Submission) error {
+	if len(batch) == 0 || len(batch) > MaxBatch {
+		return fmt.Errorf("batch of %d submissions, want 1 to %d", len(batch), MaxBatch)
+	}
+	payload := binary.LittleEndian.AppendUint16(nil, uint16(len(batch)))
+	for _, s := range batch {
+		if len(s.Signature) > math.MaxUint16 {
+			return errors.New("signature too long")
+		}
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(s.Num))
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(len(s.Signature)))
+		payload = append(payload, s.Signature...)
+	}
+	return WriteFrame(w, FrameSubmitBatch, payload)
+}
+
+// Decodes a batch frame payload, the signatures point into the payload
+func DecodeSubmitBatch(payload []byte) ([]Submission, error) {
+	if len(payload) < 2 {
+		return nil, errors.New("batch payload too short")
+	}
+	n := int(binary.LittleEndian.Uint16(payload))
+	if n == 0 || n > MaxBatch {
+		return nil, fmt.Errorf("batch of %d submissions, want 1 to %d", n, MaxBatch)
+	}
+	batch := make([]Submission, n)
+	rest := payload[2:]
+	for i := range batch {
+		if len(rest) < 6 {
+			return nil, errors.New("batch payload truncated")
+		}
+		size := 6 + int(binary.LittleEndian.Uint16(rest[4:6]))
+		if len(rest) < size {
+			return nil, errors.New("batch signature truncated")
+		}
+		batch[i] = Submission{Num: int32(binary.LittleEndian.Uint32(rest)), Signature: rest[6:size]}
+		rest = rest[size:]
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after batch", len(rest))
+	}
+	return batch, nil
+}
+
+// Writes the status codes of a batch, 4 bytes little endian each
+func WriteBatchResponse(w io.Writer, statuses []int32) error {
+	payload := make([]byte, 0, 4*len(statuses))
+	for _, status := range statuses {
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(status))
+	}
+	return WriteFrame(w, FrameBatchResponse, payload)
+}
+
+// Decodes a batch response frame payload
+func DecodeBatchResponse(payload []byte) ([]int32, error) {
+	if len(payload)%4 != 0 {
+		return nil, errors.New("invalid batch response payload length")
+	}
+	statuses := make([]int32, len(payload)/4)
+	for i := range statuses {
+		statuses[i] = int32(binary.LittleEndian.Uint32(payload[4*i:]))
+	}
+	return statuses, nil
+}
+
+// Writes a response frame with the given status code
+func WriteResponse(w io.Writer, status int32) error {
+	var payload [4]byte
+	binary.LittleEndian.PutUint32(payload[:], uint32(status))
+	return WriteFrame(w, FrameResponse, payload[:])
+}
+
+// Decodes a response frame payload
+func DecodeResponse(payload []byte) (int32, error) {
+	if len(payload) != 4 {
+		return 0, errors.New("invalid response payload length")
+	}
+	return int32(binary.LittleEndian.Uint32(payload)), nil
+}
@@ -0,0 +1,304 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestWriteAndReadFrame(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, FrameSubmit, []byte("payload")); err != nil {
+		t.Fatalf("WriteFrame() failed: %v", err)
+	}
+	if err := WriteFrame(&buf, FrameResponse, nil); err != nil {
+		t.Fatalf("WriteFrame() with empty payload failed: %v", err)
+	}
+
+	typ, payload, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrame() failed: %v", err)
+	}
+	if typ != FrameSubmit || string(payload) != "payload" {
+		t.Errorf("ReadFrame() = (%d, %q), want (%d, %q)", typ, payload, FrameSubmit, "payload")
+	}
+
+	typ, payload, err = ReadFrame(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrame() failed: %v", err)
+	}
+	if typ != FrameResponse || len(payload) != 0 {
+		t.Errorf("ReadFrame() = (%d, %q), want (%d, empty)", typ, payload, FrameResponse)
+	}
+
+	if _, _, err = ReadFrame(&buf); err != io.EOF {
+		t.Errorf("ReadFrame() on empty stream error = %v, want EOF", err)
+	}
+}
+
+func TestFramePayloadTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, FrameSubmit, make([]byte, MaxPayload+1)); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("WriteFrame() with oversized payload error = %v, want ErrPayloadTooLarge", err)
+	}
+
+	// Header announcing an oversized payload
+	buf.Write([]byte{byte(FrameSubmit), 0xff, 0xff, 0xff, 0x7f})
+	if _, _, err := ReadFrame(&buf); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("ReadFrame() with oversized payload error = %v, want ErrPayloadTooLarge", err)
+	}
+}
+
+func TestReadFrameOf(t *testing.T) {
+	var buf bytes.Buffer
+	WriteResponse(&buf, StatusAdded)
+	if _, err := ReadFrameOf(&buf, FrameWelcome); err == nil {
+		t.Errorf("ReadFrameOf(FrameWelcome) on a response frame did not fail, want error")
+	}
+}
+
+func TestHelloAndWelcomeJSON(t *testing.T) {
+	var buf bytes.Buffer
+	hello := Hello{Room: "red", PublicKey: []byte("-----BEGIN PUBLIC KEY-----"), ResumeToken: "token", WantRange: true}
+	if err := WriteJSON(&buf, FrameHello, hello); err != nil {
+		t.Fatalf("WriteJSON(Hello) failed: %v", err)
+	}
+	welcome := Welcome{ClientID: 7, Room: "red", Max: 200, Rule: "prime", Rounds: 3, IdleTimeout: 30000,
+		ResumeToken: "token", Resumed: true, Acked: 12, LastStatus: StatusDuplicate, Rotations: 2,
+		Range: &Range{Lo: 2, Hi: 65538}, UnitID: 1}
+	if err := WriteJSON(&buf, FrameWelcome, welcome); err != nil {
+		t.Fatalf("WriteJSON(Welcome) failed: %v", err)
+	}
+
+	payload, err := ReadFrameOf(&buf, FrameHello)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameHello) failed: %v", err)
+	}
+	var gotHello Hello
+	if err := DecodeJSON(payload, &gotHello); err != nil {
+		t.Fatalf("DecodeJSON(Hello) failed: %v", err)
+	}
+	if !reflect.DeepEqual(gotHello, hello) {
+		t.Errorf("DecodeJSON(Hello) = %+v, want %+v", gotHello, hello)
+	}
+
+	payload, err = ReadFrameOf(&buf, FrameWelcome)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameWelcome) failed: %v", err)
+	}
+	var gotWelcome Welcome
+	if err := DecodeJSON(payload, &gotWelcome); err != nil {
+		t.Fatalf("DecodeJSON(Welcome) failed: %v", err)
+	}
+	if !reflect.DeepEqual(gotWelcome, welcome) {
+		t.Errorf("DecodeJSON(Welcome) = %+v, want %+v", gotWelcome, welcome)
+	}
+}
+
+func TestSubmitAndResponse(t *testing.T) {
+	var buf bytes.Buffer
+	sig := []byte{1, 2, 3, 4, 5}
+	if err := WriteSubmit(&buf, -42, sig); err != nil {
+		t.Fatalf("WriteSubmit() failed: %v", err)
+	}
+	if err := WriteResponse(&buf, StatusInvalidSignature); err != nil {
+		t.Fatalf("WriteResponse() failed: %v", err)
+	}
+
+	payload, err := ReadFrameOf(&buf, FrameSubmit)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameSubmit) failed: %v", err)
+	}
+	num, gotSig, err := DecodeSubmit(payload)
+	if err != nil {
+		t.Fatalf("DecodeSubmit() failed: %v", err)
+	}
+	if num != -42 || !bytes.Equal(gotSig, sig) {
+		t.Errorf("DecodeSubmit() = (%d, %v), want (-42, %v)", num, gotSig, sig)
+	}
+
+	payload, err = ReadFrameOf(&buf, FrameResponse)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameResponse) failed: %v", err)
+	}
+	status, err := DecodeResponse(payload)
+	if err != nil {
+		t.Fatalf("DecodeResponse() failed: %v", err)
+	}
+	if status != StatusInvalidSignature {
+		t.Errorf("DecodeResponse() = %d, want %d", status, StatusInvalidSignature)
+	}
+
+	if _, _, err := DecodeSubmit([]byte{1, 2}); err == nil {
+		t.Errorf("DecodeSubmit(short payload) did not fail, want error")
+	}
+	if _, err := DecodeResponse([]byte{1}); err == nil {
+		t.Errorf("DecodeResponse(short payload) did not fail, want error")
+	}
+}
+
+func TestSubmitCertified(t *testing.T) {
+	var buf bytes.Buffer
+	sig, cert := []byte{1, 2, 3}, []byte{4, 5, 6, 7}
+	if err := WriteSubmitCertified(&buf, 97, sig, cert); err != nil {
+		t.Fatalf("WriteSubmitCertified() failed: %v", err)
+	}
+	payload, err := ReadFrameOf(&buf, FrameSubmitCertified)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameSubmitCertified) failed: %v", err)
+	}
+	num, gotSig, gotCert, err := DecodeSubmitCertified(payload)
+	if err != nil {
+		t.Fatalf("DecodeSubmitCertified() failed: %v", err)
+	}
+	if num != 97 || !bytes.Equal(gotSig, sig) || !bytes.Equal(gotCert, cert) {
+		t.Errorf("DecodeSubmitCertified() = (%d, %v, %v), want (97, %v, %v)", num, gotSig, gotCert, sig, cert)
+	}
+
+	if _, _, _, err := DecodeSubmitCertified([]byte{97, 0, 0, 0, 9, 0, 1}); err == nil {
+		t.Errorf("DecodeSubmitCertified(truncated signature) did not fail, want error")
+	}
+}
+
+func TestSubmitBatchAndResponse(t *testing.T) {
+	var buf bytes.Buffer
+	batch := []Submission{{Num: 2, Signature: []byte{1, 2}}, {Num: -3, Signature: nil}, {Num: 5, Signature: []byte{3}}}
+	if err := WriteSubmitBatch(&buf, batch); err != nil {
+		t.Fatalf("WriteSubmitBatch() failed: %v", err)
+	}
+	statuses := []int32{StatusAdded, StatusDuplicate, StatusInvalidSignature}
+	if err := WriteBatchResponse(&buf, statuses); err != nil {
+		t.Fatalf("WriteBatchResponse() failed: %v", err)
+	}
+
+	payload, err := ReadFrameOf(&buf, FrameSubmitBatch)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameSubmitBatch) failed: %v", err)
+	}
+	got, err := DecodeSubmitBatch(payload)
+	if err != nil {
+		t.Fatalf("DecodeSubmitBatch() failed: %v", err)
+	}
+	batch[1].Signature = []byte{} // Empty signatures decode as empty slices of the payload
+	if !reflect.DeepEqual(got, batch) {
+		t.Errorf("DecodeSubmitBatch() = %v, want %v", got, batch)
+	}
+	for _, bad := range [][]byte{{0, 0}, payload[:len(payload)-1], append(payload, 0)} {
+		if _, err := DecodeSubmitBatch(bad); err == nil {
+			t.Errorf("DecodeSubmitBatch(%v) did not fail, want error", bad)
+		}
+	}
+
+	payload, err = ReadFrameOf(&buf, FrameBatchResponse)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameBatchResponse) failed: %v", err)
+	}
+	gotStatuses, err := DecodeBatchResponse(payload)
+	if err != nil {
+		t.Fatalf("DecodeBatchResponse() failed: %v", err)
+	}
+	if !reflect.DeepEqual(gotStatuses, statuses) {
+		t.Errorf("DecodeBatchResponse() = %v, want %v", gotStatuses, statuses)
+	}
+
+	if err := WriteSubmitBatch(&buf, make([]Submission, MaxBatch+1)); err == nil {
+		t.Errorf("WriteSubmitBatch(%d submissions) did not fail, want error", MaxBatch+1)
+	}
+}
+
+func TestRotateKeyJSON(t *testing.T) {
+	var buf bytes.Buffer
+	rotate := RotateKey{PublicKey: []byte("-----BEGIN PUBLIC KEY-----"), Signature: []byte{1, 2}, NewSignature: []byte{3, 4}}
+	ack := RotateKeyAck{Message: "invalid signature of the current key"}
+	WriteJSON(&buf, FrameRotateKey, rotate)
+	WriteJSON(&buf, FrameRotateKeyAck, ack)
+
+	var gotRotate RotateKey
+	var gotAck RotateKeyAck
+	for _, f := range []struct {
+		frameType FrameType
+		v         any
+	}{{FrameRotateKey, &gotRotate}, {FrameRotateKeyAck, &gotAck}} {
+		payload, err := ReadFrameOf(&buf, f.frameType)
+		if err != nil {
+			t.Fatalf("ReadFrameOf(%d) failed: %v", f.frameType, err)
+		}
+		if err := DecodeJSON(payload, f.v); err != nil {
+			t.Fatalf("DecodeJSON(%d) failed: %v", f.frameType, err)
+		}
+	}
+	if !reflect.DeepEqual(gotRotate, rotate) || gotAck != ack {
+		t.Errorf("Decoded %+v, %+v, want %+v, %+v", gotRotate, gotAck, rotate, ack)
+	}
+}
+
+func TestAnnouncementJSON(t *testing.T) {
+	var buf bytes.Buffer
+	want := Announcement{Kind: AnnounceRoundResult, Room: "red", Round: 2, Scoreboard: map[int32]int{1: 3, 7: 5}}
+	if err := WriteJSON(&buf, FrameAnnouncement, want); err != nil {
+		t.Fatalf("WriteJSON(Announcement) failed: %v", err)
+	}
+	payload, err := ReadFrameOf(&buf, FrameAnnouncement)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameAnnouncement) failed: %v", err)
+	}
+	var got Announcement
+	if err := DecodeJSON(payload, &got); err != nil {
+		t.Fatalf("DecodeJSON(Announcement) failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeJSON(Announcement) = %+v, want %+v", got, want)
+	}
+}
+
+func TestLeaderboardJSON(t *testing.T) {
+	var buf bytes.Buffer
+	you := LeaderboardEntry{ClientID: 7, Rank: 2, Score: 4, Accepted: 5, Duplicate: 1, Invalid: 2}
+	want := Leaderboard{Room: "red", Round: 1, PoolLength: 12, Max: 20, Clients: 2,
+		Top: []LeaderboardEntry{{ClientID: 3, Rank: 1, Score: 7, Accepted: 7}, you}, You: &you}
+	if err := WriteJSON(&buf, FrameLeaderboard, want); err != nil {
+		t.Fatalf("WriteJSON(Leaderboard) failed: %v", err)
+	}
+	payload, err := ReadFrameOf(&buf, FrameLeaderboard)
+	if err != nil {
+		t.Fatalf("ReadFrameOf(FrameLeaderboard) failed: %v", err)
+	}
+	var got Leaderboard
+	if err := DecodeJSON(payload, &got); err != nil {
+		t.Fatalf("DecodeJSON(Leaderboard) failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeJSON(Leaderboard) = %+v, want %+v", got, want)
+	}
+}
+
+func TestLeaseAndCompleteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	lease := Lease{UnitID: 3, Range: Range{Lo: 131074, Hi: 196610}, TTL: 120000}
+	complete := Complete{UnitID: 3, Found: 5420}
+	ack := CompleteAck{Message: "unit 3 is leased to another client"}
+	WriteJSON(&buf, FrameLease, lease)
+	WriteJSON(&buf, FrameComplete, complete)
+	WriteJSON(&buf, FrameCompleteAck, ack)
+
+	var gotLease Lease
+	var gotComplete Complete
+	var gotAck CompleteAck
+	for _, f := range []struct {
+		frameType FrameType
+		v         any
+	}{{FrameLease, &gotLease}, {FrameComplete, &gotComplete}, {FrameCompleteAck, &gotAck}} {
+		payload, err := ReadFrameOf(&buf, f.frameType)
+		if err != nil {
+			t.Fatalf("ReadFrameOf(%d) failed: %v", f.frameType, err)
+		}
+		if err := DecodeJSON(payload, f.v); err != nil {
+			t.Fatalf("DecodeJSON(%d) failed: %v", f.frameType, err)
+		}
+	}
+	if gotLease != lease || gotComplete != complete || gotAck != ack {
+		t.Errorf("Decoded %+v, %+v, %+v, want %+v, %+v, %+v", gotLease, gotComplete, gotAck, lease, complete, ack)
+	}
+}
@@ -0,0 +1,103 @@
+// Package ratelimit implements token bucket rate limiters.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// A token bucket refilled at a constant rate up to its burst size
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// Creates a full bucket allowing rate events per second with bursts of up to burst events
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	b := &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), now: time.Now}
+	b.last = b.now()
+	return b
+}
+
+// Takes a token if one is available
+func (b *Bucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Reports whether the bucket is full, i.e. it has been idle long enough to be forgotten
+func (b *Bucket) Full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens >= b.burst
+}
+
+func (b *Bucket) refill() {
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Keeps one bucket per key, e.g. per remote address
+type Keyed struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+}
+
+// Buckets kept before idle ones are dropped
+const pruneThreshold = 1024
+
+func NewKeyed(rate float64, burst int) *Keyed {
+	return &Keyed{rate: rate, burst: burst, buckets: make(map[string]*Bucket)}
+}
+
+// Takes a token from the key's bucket if one is available
+func (k *Keyed) Allow(key string) bool {
+	k.mu.Lock()
+	b, ok := k.buckets[key]
+	if !ok {
+		if len(k.buckets) >= pruneThreshold {
+			k.prune()
+		}
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.mu.Unlock()
+	return b.Allow()
+}
+
+// Drops the buckets that refilled completely, they behave like new ones. Called with mu held.
+func (k *Keyed) prune() {
+	for key, b := range k.buckets {
+		if b.Full() {
+			delete(k.buckets, key)
+		}
+	}
+}
+
+// Number of tracked keys
+func (k *Keyed) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.buckets)
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	b := NewBucket(2, 3) // 2 tokens per second, bursts of 3
+	now := time.Unix(0, 0)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	for i := range 3 {
+		if !b.Allow() {
+			t.Fatalf("Allow() #%d = false, want true within burst", i+1)
+		}
+	}
+	if b.Allow() {
+		t.Errorf("Allow() = true after burst, want false")
+	}
+
+	now = now.Add(250 * time.Millisecond) // Half a token
+	if b.Allow() {
+		t.Errorf("Allow() = true after 250ms, want false")
+	}
+	now = now.Add(250 * time.Millisecond) // One token
+	if !b.Allow() {
+		t.Errorf("Allow() = false after 500ms, want true")
+	}
+
+	now = now.Add(time.Hour)
+	if !b.Full() {
+		t.Errorf("Full() = false after an hour, want true")
+	}
+	for i := range 3 {
+		if !b.Allow() {
+			t.Errorf("Allow() #%d = false after refill, want true", i+1)
+		}
+	}
+	if b.Allow() {
+		t.Errorf("Allow() = true beyond burst after refill, want false")
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	k := NewKeyed(1, 1)
+	if !k.Allow("a") {
+		t.Errorf("Allow(a) = false, want true")
+	}
+	if k.Allow("a") {
+		t.Errorf("Allow(a) = true twice in a row, want false")
+	}
+	if !k.Allow("b") {
+		t.Errorf("Allow(b) = false, want true as keys are independent")
+	}
+	if k.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", k.Len())
+	}
+}
+
+func TestKeyedPrune(t *testing.T) {
+	k := NewKeyed(1000000, 1) // Buckets refill almost instantly
+	for i := range pruneThreshold {
+		k.Allow(strconv.Itoa(i))
+	}
+	time.Sleep(time.Millisecond)
+	k.Allow("new")
+	if k.Len() != 1 {
+		t.Errorf("Len() = %d after pruning, want 1", k.Len())
+	}
+}